@@ -7,6 +7,20 @@ import (
 
 // DefinitionsTable is used to marshal input json into a data structure
 type DefinitionsTable struct {
-	RegularExpressions map[string]lexer.RegularExpression `json:"regularExpressions"`
-	Grammar            parser.Grammar                     `json:"grammar"`
+	RegularExpressions lexer.TokenDefinitions `json:"regularExpressions"`
+	SkipTokens         []string               `json:"skipTokens"`
+	Grammar            parser.Grammar         `json:"grammar"`
+}
+
+func (d DefinitionsTable) tokenTypes() []string {
+	tokenTypes := make([]string, 0, len(d.RegularExpressions))
+	for _, definition := range d.RegularExpressions {
+		tokenTypes = append(tokenTypes, definition.TokenType)
+	}
+	return tokenTypes
+}
+
+// Validate checks the grammar, including that each of its terminals has a regular expression.
+func (d DefinitionsTable) Validate() []parser.Diagnostic {
+	return d.Grammar.Validate(d.tokenTypes())
 }
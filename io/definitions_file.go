@@ -0,0 +1,532 @@
+package io
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/SaurabhJha/lexpar/lexer"
+	"github.com/SaurabhJha/lexpar/parser"
+)
+
+// ReadDefinitionsFile reads definitions from a file. Files ending in ".lexpar" are read with ParseLexpar, and all
+// the others are read as JSON.
+func ReadDefinitionsFile(path string) (DefinitionsTable, error) {
+	var definitions DefinitionsTable
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return definitions, err
+	}
+	if filepath.Ext(path) == ".lexpar" {
+		definitions, err = ParseLexpar(string(content))
+	} else {
+		err = json.Unmarshal(content, &definitions)
+	}
+	if err != nil {
+		return definitions, fmt.Errorf("%v: %v", path, err)
+	}
+	return definitions, nil
+}
+
+// WriteDefinitionsFile writes definitions to a file, replacing what it had. Files ending in ".lexpar" are written
+// with FormatLexpar, and all the others are written as JSON.
+func WriteDefinitionsFile(path string, definitions DefinitionsTable) error {
+	var content []byte
+	var err error
+	if filepath.Ext(path) == ".lexpar" {
+		var text string
+		text, err = FormatLexpar(definitions)
+		content = []byte(text)
+	} else {
+		content, err = json.MarshalIndent(definitions, "", "\t")
+	}
+	if err != nil {
+		return fmt.Errorf("%v: %v", path, err)
+	}
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	_, err = file.Write(content)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// lexparTokens are the tokens of the lexpar format. Keywords come before ident so that they win.
+var lexparTokens = []lexer.TokenDefinition{
+	{TokenType: "whitespace", Regex: "[ \t\r\n]+"},
+	{TokenType: "comment", Regex: "#[^\n]*"},
+	{TokenType: "%token", Regex: "%token"},
+	{TokenType: "%skip", Regex: "%skip"},
+	{TokenType: "%start", Regex: "%start"},
+	{TokenType: "%mode", Regex: "%mode"},
+	{TokenType: "%left", Regex: "%left"},
+	{TokenType: "%right", Regex: "%right"},
+	{TokenType: "%nonassoc", Regex: "%nonassoc"},
+	{TokenType: "%prec", Regex: "%prec"},
+	{TokenType: "%%", Regex: "%%"},
+	{TokenType: "->", Regex: "->"},
+	{TokenType: "|", Regex: "/|"},
+	{TokenType: ";", Regex: ";"},
+	{TokenType: "{", Regex: "/{"},
+	{TokenType: "}", Regex: "/}"},
+	{TokenType: "=", Regex: "="},
+	{TokenType: "(", Regex: "/("},
+	{TokenType: ")", Regex: "/)"},
+	{TokenType: "*", Regex: "/*"},
+	{TokenType: "+", Regex: "/+"},
+	{TokenType: "?", Regex: "/?"},
+	{TokenType: "number", Regex: "[0-9]+"},
+	{TokenType: "ident", Regex: "[A-Za-z_][A-Za-z0-9_']*"},
+	{TokenType: "string", Regex: "\"([^\"\\]|\\.)*\""},
+}
+
+// lexparGrammar is the grammar of the lexpar format. Its syntax tree has a node per declaration and per rule,
+// labelled with what they declare, for lexparTree to read the definitions off.
+var lexparGrammar = parser.Grammar{
+	Start: "lexpar'",
+	Productions: []parser.Production{
+		{Head: "lexpar'", EBNF: "file"},
+		{Head: "file", EBNF: "decl* %% rule*", Rule: parser.SemanticRule{Type: "tree", RootLabel: "file", Children: []int{0, 2}}},
+		{Head: "decl", EBNF: "%token name string", Rule: parser.SemanticRule{Type: "tree", RootLabel: "token", Children: []int{1, 2}}},
+		{Head: "decl", EBNF: "%skip name string", Rule: parser.SemanticRule{Type: "tree", RootLabel: "skip", Children: []int{1, 2}}},
+		{Head: "decl", EBNF: "%start name", Rule: parser.SemanticRule{Type: "tree", RootLabel: "start", Children: []int{1}}},
+		{Head: "decl", EBNF: "%mode name", Rule: parser.SemanticRule{Type: "tree", RootLabel: "mode", Children: []int{1}}},
+		{Head: "decl", EBNF: "(%left | %right | %nonassoc) name+", Rule: parser.SemanticRule{Type: "tree", RootLabel: "precedence", Children: []int{0, 1}}},
+		{Head: "rule", EBNF: "ident -> alts ;", Rule: parser.SemanticRule{Type: "tree", RootLabel: "rule", Children: []int{0, 2}}},
+		{Head: "alts", EBNF: "alt", Rule: parser.SemanticRule{Type: "tree", RootLabel: "alts", Children: []int{0}}},
+		{Head: "alts", EBNF: "alts '|' alt", Rule: parser.SemanticRule{Type: "append", Children: []int{0, 2}}},
+		{Head: "alt", EBNF: "item* prec? action?", Rule: parser.SemanticRule{Type: "tree", RootLabel: "alt", Children: []int{0, 1, 2}}},
+		{Head: "item", EBNF: "name"},
+		{Head: "item", EBNF: "item '*'", Rule: parser.SemanticRule{Type: "tree", RootLabel: "*", Children: []int{0}}},
+		{Head: "item", EBNF: "item '+'", Rule: parser.SemanticRule{Type: "tree", RootLabel: "+", Children: []int{0}}},
+		{Head: "item", EBNF: "item '?'", Rule: parser.SemanticRule{Type: "tree", RootLabel: "?", Children: []int{0}}},
+		{Head: "item", EBNF: "'(' group ')'", Rule: parser.SemanticRule{Type: "copy", Children: []int{1}}},
+		{Head: "group", EBNF: "item*", Rule: parser.SemanticRule{Type: "tree", RootLabel: "()", Children: []int{0}}},
+		{Head: "group", EBNF: "group '|' item*", Rule: parser.SemanticRule{Type: "append", Children: []int{0, 2}}},
+		{Head: "prec", EBNF: "%prec name", Rule: parser.SemanticRule{Type: "tree", RootLabel: "prec", Children: []int{1}}},
+		{Head: "action", EBNF: "'{' ident (string | number | ident | attribute)* '}'", Rule: parser.SemanticRule{Type: "tree", RootLabel: "action", Children: []int{1, 2}}},
+		{Head: "attribute", EBNF: "ident '=' (string | ident)", Rule: parser.SemanticRule{Type: "tree", RootLabel: "=", Children: []int{0, 2}}},
+		{Head: "name", EBNF: "ident | string"},
+	},
+}
+
+// ParseLexpar reads definitions written in the lexpar format. Tokens are declared with "%token name regex" and
+// skipped tokens with "%skip name regex". The other declarations are "%start", "%mode" and precedence levels
+// written with "%left", "%right" and "%nonassoc". After "%%" come the productions, like
+//
+//	expr -> expr "+" term { tree "+" 0 2 } | term ;
+//	call -> ident "(" args ")" { tree "$0" 2 kind="call" } ;
+//	args -> expr ("," expr)* ;
+//
+// Names can be written bare or quoted, and regular expressions, labels and attribute values are quoted like Go
+// strings. Alternatives using *, +, ? or parentheses become productions with an EBNF body.
+func ParseLexpar(text string) (DefinitionsTable, error) {
+	var definitions DefinitionsTable
+	var tok lexer.Tokenizer
+	tok.Init(lexparTokens)
+	tok.Skip([]string{"whitespace", "comment"})
+	tokens, err := tok.Tokenize(text)
+	if err != nil {
+		return definitions, err
+	}
+
+	var pars parser.Parser
+	if err := pars.Init(lexparGrammar); err != nil {
+		return definitions, err
+	}
+	tree, err := pars.Parse(tokens)
+	if err != nil {
+		return definitions, err
+	}
+	err = lexparTree{tree}.read(&definitions)
+	return definitions, err
+}
+
+// lexparTree is the syntax tree of a lexpar file.
+type lexparTree struct {
+	parser.SyntaxGraph
+}
+
+func (t lexparTree) label(node int) string {
+	return t.NodeLabel[node]
+}
+
+func (t lexparTree) children(node int) []int {
+	return t.Graph[node]
+}
+
+// name returns what a bare or quoted name stands for.
+func (t lexparTree) name(node int) (string, error) {
+	if !strings.HasPrefix(t.label(node), "\"") {
+		return t.label(node), nil
+	}
+	unquoted, err := strconv.Unquote(t.label(node))
+	if err != nil {
+		position := t.NodePosition[node]
+		return "", fmt.Errorf("%d:%d: invalid string %v", position.Line, position.Column, t.label(node))
+	}
+	return unquoted, nil
+}
+
+func (t lexparTree) names(nodes []int) ([]string, error) {
+	names := make([]string, 0, len(nodes))
+	for _, node := range nodes {
+		name, err := t.name(node)
+		if err != nil {
+			return nil, err
+		}
+		names = append(names, name)
+	}
+	return names, nil
+}
+
+// read fills definitions with the declarations and the productions of the file.
+func (t lexparTree) read(definitions *DefinitionsTable) error {
+	decls, rules := t.children(t.Root)[0], t.children(t.Root)[1]
+	for _, decl := range t.children(decls) {
+		if t.label(decl) == "precedence" {
+			associativity := parser.Associativity(strings.TrimPrefix(t.label(t.children(decl)[0]), "%"))
+			terminals, err := t.names(t.children(t.children(decl)[1]))
+			if err != nil {
+				return err
+			}
+			definitions.Grammar.AddPrecedenceLevel(associativity, terminals)
+			continue
+		}
+
+		args, err := t.names(t.children(decl))
+		if err != nil {
+			return err
+		}
+		switch t.label(decl) {
+		case "token":
+			definitions.RegularExpressions.Set(args[0], lexer.RegularExpression(args[1]))
+		case "skip":
+			definitions.RegularExpressions.Set(args[0], lexer.RegularExpression(args[1]))
+			definitions.SkipTokens = append(definitions.SkipTokens, args[0])
+		case "start":
+			definitions.Grammar.SetStartSymbol(args[0])
+		case "mode":
+			definitions.Grammar.Mode = parser.ConstructionMode(args[0])
+		}
+	}
+
+	// Like yacc, the head of the first production is the start symbol unless there is a %start.
+	for _, rule := range t.children(rules) {
+		head := t.label(t.children(rule)[0])
+		if definitions.Grammar.Start == "" {
+			definitions.Grammar.SetStartSymbol(head)
+		}
+		for _, alt := range t.children(t.children(rule)[1]) {
+			if err := t.readAlternative(definitions, head, alt); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// readAlternative adds the production written by an alternative of a rule. The items of the body come first,
+// followed by the precedence of the production and its action if they are given. A body made of names only is a
+// plain body, and any other body is written back in EBNF.
+func (t lexparTree) readAlternative(definitions *DefinitionsTable, head string, alt int) error {
+	var body []string
+	ebnf := ""
+	var rule parser.SemanticRule
+	precedence := ""
+	for _, part := range t.children(alt) {
+		var err error
+		switch t.label(part) {
+		case "list":
+			if t.isPlain(t.children(part)) {
+				body, err = t.names(t.children(part))
+			} else {
+				ebnf, err = t.ebnfSequence(t.children(part))
+			}
+		case "prec":
+			precedence, err = t.name(t.children(part)[0])
+		case "action":
+			rule, err = t.readAction(part)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if ebnf != "" {
+		definitions.Grammar.AddEbnfProduction(head, ebnf, rule, precedence)
+	} else {
+		definitions.Grammar.AddProduction(head, body, rule, precedence)
+	}
+	return nil
+}
+
+// isPlain tells whether the items of a body are all names.
+func (t lexparTree) isPlain(items []int) bool {
+	for _, item := range items {
+		if t.isOperator(item) {
+			return false
+		}
+	}
+	return true
+}
+
+// isOperator tells whether an item of a body is a repetition, an optional item or a group rather than a name. Their
+// labels can not be names, which are identifiers or quoted strings.
+func (t lexparTree) isOperator(item int) bool {
+	switch t.label(item) {
+	case "*", "+", "?", "()":
+		return true
+	}
+	return false
+}
+
+// ebnfSequence writes a sequence of items in EBNF.
+func (t lexparTree) ebnfSequence(items []int) (string, error) {
+	ebnf := make([]string, 0, len(items))
+	for _, item := range items {
+		s, err := t.ebnfItem(item)
+		if err != nil {
+			return "", err
+		}
+		ebnf = append(ebnf, s)
+	}
+	return strings.Join(ebnf, " "), nil
+}
+
+// ebnfItem writes an item of a body in EBNF. Names with EBNF operators or spaces in them are quoted.
+func (t lexparTree) ebnfItem(item int) (string, error) {
+	switch t.label(item) {
+	case "*", "+", "?":
+		s, err := t.ebnfItem(t.children(item)[0])
+		return s + t.label(item), err
+	case "()":
+		alternatives := make([]string, 0, len(t.children(item)))
+		for _, sequence := range t.children(item) {
+			s, err := t.ebnfSequence(t.children(sequence))
+			if err != nil {
+				return "", err
+			}
+			alternatives = append(alternatives, s)
+		}
+		return "(" + strings.Join(alternatives, " | ") + ")", nil
+	}
+
+	name, err := t.name(item)
+	if err != nil {
+		return "", err
+	}
+	quoted := strings.HasPrefix(name, "'") || strings.ContainsAny(name, "()|*+? \t\r\n")
+	if name == "" || quoted && strings.Contains(name, "'") {
+		position := t.NodePosition[item]
+		return "", fmt.Errorf("%d:%d: %v can not be used with *, +, ? or parentheses", position.Line, position.Column, t.label(item))
+	}
+	if quoted {
+		return "'" + name + "'", nil
+	}
+	return name, nil
+}
+
+// readAction reads an action like { tree "+" 0 2 op="add" } into a semantic rule. The numbers are the children of
+// the rule, the arguments like name=value are its attributes and the other argument is its root label.
+func (t lexparTree) readAction(action int) (parser.SemanticRule, error) {
+	rule := parser.SemanticRule{Type: t.label(t.children(action)[0])}
+	for _, arg := range t.children(t.children(action)[1]) {
+		if t.label(arg) == "=" && len(t.children(arg)) == 2 {
+			value, err := t.name(t.children(arg)[1])
+			if err != nil {
+				return rule, err
+			}
+			if rule.Attributes == nil {
+				rule.Attributes = make(map[string]string)
+			}
+			rule.Attributes[t.label(t.children(arg)[0])] = value
+			continue
+		}
+		if child, err := strconv.Atoi(t.label(arg)); err == nil {
+			rule.Children = append(rule.Children, child)
+			continue
+		}
+		label, err := t.name(arg)
+		if err != nil {
+			return rule, err
+		}
+		rule.RootLabel = label
+	}
+	return rule, nil
+}
+
+// lexparIdent matches the names which can be written bare in the lexpar format.
+var lexparIdent = regexp.MustCompile("^[A-Za-z_][A-Za-z0-9_']*$")
+
+// FormatLexpar writes definitions in the lexpar format, so that ParseLexpar reads them back. The declarations come
+// first, and the productions of a head are written as the alternatives of a rule. The alternatives at the top of an
+// EBNF body are written as alternatives of their own, which desugar to the same productions.
+func FormatLexpar(definitions DefinitionsTable) (string, error) {
+	var b strings.Builder
+	skipped := make(map[string]bool)
+	for _, tokenType := range definitions.SkipTokens {
+		skipped[tokenType] = true
+	}
+	for _, definition := range definitions.RegularExpressions {
+		keyword := "%token"
+		if skipped[definition.TokenType] {
+			keyword = "%skip"
+		}
+		fmt.Fprintf(&b, "%s %s %s\n", keyword, lexparName(definition.TokenType), strconv.Quote(string(definition.Regex)))
+	}
+	g := definitions.Grammar
+	if g.Start != "" {
+		fmt.Fprintf(&b, "%%start %s\n", lexparName(string(g.Start)))
+	}
+	if g.Mode != "" {
+		fmt.Fprintf(&b, "%%mode %s\n", lexparName(string(g.Mode)))
+	}
+	for _, level := range g.Precedence {
+		fmt.Fprintf(&b, "%%%s", level.Associativity)
+		for _, terminal := range level.Terminals {
+			fmt.Fprintf(&b, " %s", lexparName(string(terminal)))
+		}
+		b.WriteString("\n")
+	}
+
+	b.WriteString("\n%%\n")
+	for i, p := range g.Productions {
+		var alternatives []string
+		if p.EBNF == "" {
+			body := make([]string, len(p.Body))
+			for j, symbol := range p.Body {
+				body[j] = lexparName(string(symbol))
+			}
+			alternatives = []string{strings.Join(body, " ")}
+		} else {
+			var err error
+			alternatives, err = lexparEbnf(p.EBNF)
+			if err != nil {
+				return "", fmt.Errorf("EBNF body of production %v of %v: %v", i, p.Head, err)
+			}
+		}
+		action, err := lexparAction(p.Rule)
+		if err != nil {
+			return "", fmt.Errorf("rule of production %v of %v: %v", i, p.Head, err)
+		}
+		if p.Precedence != "" {
+			action = " %prec " + lexparName(string(p.Precedence)) + action
+		}
+
+		if i == 0 || g.Productions[i-1].Head != p.Head {
+			fmt.Fprintf(&b, "\n%s ->", lexparName(string(p.Head)))
+		} else {
+			b.WriteString("\n    |")
+		}
+		for j, alternative := range alternatives {
+			if j > 0 {
+				b.WriteString("\n    |")
+			}
+			if alternative != "" {
+				b.WriteString(" " + alternative)
+			}
+			b.WriteString(action)
+		}
+		if i == len(g.Productions)-1 || g.Productions[i+1].Head != p.Head {
+			b.WriteString("\n    ;\n")
+		}
+	}
+	return b.String(), nil
+}
+
+// lexparName writes a name bare if it can be, and quoted otherwise.
+func lexparName(name string) string {
+	if lexparIdent.MatchString(name) {
+		return name
+	}
+	return strconv.Quote(name)
+}
+
+// lexparAction writes a semantic rule as an action, or nothing for a production without a rule. The attributes are
+// sorted by name so that the output does not change from one run to the next.
+func lexparAction(rule parser.SemanticRule) (string, error) {
+	if rule.Type == "" {
+		return "", nil
+	}
+	if !lexparIdent.MatchString(rule.Type) {
+		return "", fmt.Errorf("invalid rule type %q", rule.Type)
+	}
+	action := []string{"{", rule.Type}
+	if rule.RootLabel != "" {
+		action = append(action, strconv.Quote(rule.RootLabel))
+	}
+	for _, child := range rule.Children {
+		action = append(action, strconv.Itoa(child))
+	}
+	names := make([]string, 0, len(rule.Attributes))
+	for name := range rule.Attributes {
+		if !lexparIdent.MatchString(name) {
+			return "", fmt.Errorf("invalid attribute name %q", name)
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		action = append(action, name+"="+strconv.Quote(rule.Attributes[name]))
+	}
+	return " " + strings.Join(append(action, "}"), " "), nil
+}
+
+// lexparEbnf writes the alternatives at the top of an EBNF body in the lexpar format, where names are quoted like
+// Go strings rather than with single quotes.
+func lexparEbnf(ebnf string) ([]string, error) {
+	alternatives := make([]string, 0, 1)
+	alternative := ""
+	depth := 0
+	for i := 0; i < len(ebnf); {
+		switch c := ebnf[i]; {
+		case strings.IndexByte(" \t\r\n", c) >= 0:
+			i++
+		case c == '|' && depth == 0:
+			alternatives = append(alternatives, alternative)
+			alternative = ""
+			i++
+		case strings.IndexByte("()|*+?", c) >= 0:
+			if c == '(' {
+				depth++
+			} else if c == ')' {
+				depth--
+			}
+			alternative = appendEbnf(alternative, ebnf[i:i+1])
+			i++
+		case c == '\'':
+			length := strings.IndexByte(ebnf[i+1:], '\'')
+			if length < 0 {
+				return nil, fmt.Errorf("unterminated quoted symbol at %v", i)
+			}
+			alternative = appendEbnf(alternative, lexparName(ebnf[i+1:i+1+length]))
+			i += length + 2
+		default:
+			j := i
+			for j < len(ebnf) && strings.IndexByte(" \t\r\n()|*+?", ebnf[j]) < 0 {
+				j++
+			}
+			alternative = appendEbnf(alternative, lexparName(ebnf[i:j]))
+			i = j
+		}
+	}
+	return append(alternatives, alternative), nil
+}
+
+// appendEbnf appends a token to an EBNF body, with a space before it unless it closes a group, follows an opening
+// parenthesis or is a postfix operator.
+func appendEbnf(body string, token string) string {
+	if body == "" || strings.HasSuffix(body, "(") || strings.Contains(")*+?", token) {
+		return body + token
+	}
+	return body + " " + token
+}
@@ -0,0 +1,252 @@
+package io
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/SaurabhJha/lexpar/lexer"
+	"github.com/SaurabhJha/lexpar/parser"
+)
+
+func TestParseLexpar(t *testing.T) {
+	text := `
+# Comments run to the end of the line.
+%token number "[0-9]+"
+%token "+" "/+"
+%token "-" "-"
+%token "<" "<"
+%skip whitespace "[ \t\n]+"
+%mode lalr1
+%nonassoc "<"
+%left "+" "-"
+%right UMINUS
+
+%%
+
+stmt' -> stmt ;
+stmt -> expr | error | { tree "empty" } ;
+expr -> expr "+" expr { tree "+" 0 2 }
+      | expr "-" expr { tree "-" 0 2 }
+      | expr "<" expr { tree "<" 0 2 }
+      | "-" expr %prec UMINUS { tree "neg" 1 }
+      | number
+      ;
+`
+	var expected DefinitionsTable
+	json.Unmarshal([]byte(`{
+		"regularExpressions": {"number": "[0-9]+", "+": "/+", "-": "-", "<": "<", "whitespace": "[ \t\n]+"},
+		"skipTokens": ["whitespace"],
+		"grammar": {
+			"start": "stmt'",
+			"mode": "lalr1",
+			"precedence": [
+				{"associativity": "nonassoc", "terminals": ["<"]},
+				{"associativity": "left", "terminals": ["+", "-"]},
+				{"associativity": "right", "terminals": ["UMINUS"]}
+			],
+			"productions": [
+				{"head": "stmt'", "body": ["stmt"]},
+				{"head": "stmt", "body": ["expr"]},
+				{"head": "stmt", "body": ["error"]},
+				{"head": "stmt", "body": [], "rule": {"type": "tree", "rootLabel": "empty"}},
+				{"head": "expr", "body": ["expr", "+", "expr"], "rule": {"type": "tree", "rootLabel": "+", "children": [0, 2]}},
+				{"head": "expr", "body": ["expr", "-", "expr"], "rule": {"type": "tree", "rootLabel": "-", "children": [0, 2]}},
+				{"head": "expr", "body": ["expr", "<", "expr"], "rule": {"type": "tree", "rootLabel": "<", "children": [0, 2]}},
+				{"head": "expr", "body": ["-", "expr"], "rule": {"type": "tree", "rootLabel": "neg", "children": [1]}, "precedence": "UMINUS"},
+				{"head": "expr", "body": ["number"]}
+			]
+		}
+	}`), &expected)
+
+	definitions, err := ParseLexpar(text)
+	if err != nil {
+		t.Fatalf("Expected definitions to be read, got %v", err)
+	}
+	if !reflect.DeepEqual(definitions.RegularExpressions, expected.RegularExpressions) {
+		t.Errorf("Expected regular expressions %v, got %v", expected.RegularExpressions, definitions.RegularExpressions)
+	}
+	if !reflect.DeepEqual(definitions.SkipTokens, expected.SkipTokens) {
+		t.Errorf("Expected skipped tokens %v, got %v", expected.SkipTokens, definitions.SkipTokens)
+	}
+	if !reflect.DeepEqual(definitions.Grammar, expected.Grammar) {
+		t.Errorf("Expected grammar %+v, got %+v", expected.Grammar, definitions.Grammar)
+	}
+
+	var pars parser.Parser
+	if err := pars.Init(definitions.Grammar); err != nil {
+		t.Errorf("Expected grammar to compile, got %v", err)
+	}
+}
+
+func TestParseLexparStartSymbol(t *testing.T) {
+	definitions, err := ParseLexpar(`%token a "a" %% s -> a ; t -> s ;`)
+	if err != nil {
+		t.Fatalf("Expected definitions to be read, got %v", err)
+	}
+	var expected parser.Grammar
+	expected.SetStartSymbol("s")
+	if definitions.Grammar.Start != expected.Start {
+		t.Errorf("Expected the head of the first production to be the start symbol, got %v", definitions.Grammar.Start)
+	}
+}
+
+func TestParseLexparAttributes(t *testing.T) {
+	definitions, err := ParseLexpar(`%% s -> a b { leaf "$0" 1 kind="a b" base=hex } ;`)
+	if err != nil {
+		t.Fatalf("Expected definitions to be read, got %v", err)
+	}
+	expected := parser.SemanticRule{Type: "leaf", RootLabel: "$0", Children: []int{1}, Attributes: map[string]string{"kind": "a b", "base": "hex"}}
+	if got := definitions.Grammar.Productions[0].Rule; !reflect.DeepEqual(got, expected) {
+		t.Errorf("Expected rule %+v, got %+v", expected, got)
+	}
+}
+
+func TestParseLexparEbnf(t *testing.T) {
+	var testData = []struct {
+		text string
+		ebnf string
+	}{
+		{`%% args -> expr ("," expr)* ;`, "expr (, expr)*"},
+		{`%% list -> item+ "+"? ;`, "item+ '+'?"},
+		{`%% s -> (a | "b c" | ) d ;`, "(a | 'b c' | ) d"},
+		{`%% s -> (a b*)? ;`, "(a b*)?"},
+		{`%% s -> expr' * ;`, "expr'*"},
+	}
+
+	for _, test := range testData {
+		definitions, err := ParseLexpar(test.text)
+		if err != nil {
+			t.Errorf("Expected definitions to be read from %q, got %v", test.text, err)
+			continue
+		}
+		production := definitions.Grammar.Productions[0]
+		if production.EBNF != test.ebnf || len(production.Body) != 0 {
+			t.Errorf("Expected EBNF body %q for %q, got %+v", test.ebnf, test.text, production)
+		}
+	}
+
+	definitions, err := ParseLexpar(`%% s -> a (b | c) { tree "s" 0 1 } ;`)
+	if err != nil {
+		t.Fatalf("Expected definitions to be read, got %v", err)
+	}
+	var pars parser.Parser
+	if err := pars.Init(definitions.Grammar); err != nil {
+		t.Errorf("Expected grammar to compile, got %v", err)
+	}
+}
+
+func TestParseLexparErrors(t *testing.T) {
+	var testData = []struct {
+		text          string
+		expectedError string
+	}{
+		{"%token a \"a\"\ns -> a ;", "2:1: unexpected ident \"s\", expected %%"},
+		{`%% s -> "it's a"* ;`, "1:9: \"it's a\" can not be used with *, +, ? or parentheses"},
+		{"%%\ns -> a\n", "2:7: unexpected end of input, expected %prec, (, *, +, ;, ?, ident, string, {, |"},
+		{"%% s -> a { tree \"\\q\" } ;", "1:18: invalid string"},
+		{"%% s -> a ! ;", "1:11: unexpected character '!'"},
+	}
+
+	for _, test := range testData {
+		_, err := ParseLexpar(test.text)
+		if err == nil || !strings.HasPrefix(err.Error(), test.expectedError) {
+			t.Errorf("Expected error %q for %q, got %v", test.expectedError, test.text, err)
+		}
+	}
+}
+
+func TestReadDefinitionsFile(t *testing.T) {
+	fromLexpar, err := ReadDefinitionsFile("../example.lexpar")
+	if err != nil {
+		t.Fatalf("Expected example.lexpar to be read, got %v", err)
+	}
+	fromJSON, err := ReadDefinitionsFile("../example.json")
+	if err != nil {
+		t.Fatalf("Expected example.json to be read, got %v", err)
+	}
+
+	var tok lexer.Tokenizer
+	tok.Init(fromLexpar.RegularExpressions)
+	tok.Skip(fromLexpar.SkipTokens)
+	tokens, _ := tok.Tokenize("2 + x * (3 + 4)")
+	trees := make([]parser.SyntaxGraph, 0, 2)
+	for _, definitions := range []DefinitionsTable{fromLexpar, fromJSON} {
+		var pars parser.Parser
+		if err := pars.Init(definitions.Grammar); err != nil {
+			t.Fatalf("Expected grammar to compile, got %v", err)
+		}
+		tree, err := pars.Parse(tokens)
+		if err != nil {
+			t.Fatalf("Expected input to be parsed, got %v", err)
+		}
+		trees = append(trees, tree)
+	}
+	if !reflect.DeepEqual(trees[0], trees[1]) {
+		t.Errorf("Expected example.lexpar and example.json to build the same tree, got %v and %v", trees[0], trees[1])
+	}
+}
+
+func TestFormatLexpar(t *testing.T) {
+	var definitions DefinitionsTable
+	definitions.RegularExpressions.Set("id", "[a-z]+")
+	definitions.RegularExpressions.Set(",", ",")
+	definitions.RegularExpressions.Set("whitespace", " +")
+	definitions.SkipTokens = []string{"whitespace"}
+	definitions.Grammar.SetStartSymbol("args")
+	definitions.Grammar.AddEbnfProduction("args", "id (',' id)* | 'empty list'", parser.SemanticRule{Type: "copy", Children: []int{0}}, "")
+	definitions.Grammar.AddProduction("args", []string{}, parser.SemanticRule{Type: "tree", RootLabel: "none", Attributes: map[string]string{"b": "2", "a": "1"}}, ",")
+	expected := `%token id "[a-z]+"
+%token "," ","
+%skip whitespace " +"
+%start args
+
+%%
+
+args -> id ("," id)* { copy 0 }
+    | "empty list" { copy 0 }
+    | %prec "," { tree "none" a="1" b="2" }
+    ;
+`
+	text, err := FormatLexpar(definitions)
+	if err != nil {
+		t.Fatalf("Expected definitions to be formatted, got %v", err)
+	}
+	if text != expected {
+		t.Errorf("Expected definitions to be formatted as %q, got %q", expected, text)
+	}
+}
+
+func TestWriteDefinitionsFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lexpar")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	definitions, err := ReadDefinitionsFile("../example.lexpar")
+	if err != nil {
+		t.Fatalf("Expected example.lexpar to be read, got %v", err)
+	}
+	for _, name := range []string{"definitions.lexpar", "definitions.json"} {
+		// The file is longer than the definitions, to check that it is truncated.
+		path := filepath.Join(dir, name)
+		if err := ioutil.WriteFile(path, []byte(strings.Repeat("#\n", 10000)), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := WriteDefinitionsFile(path, definitions); err != nil {
+			t.Fatalf("Expected %v to be written, got %v", name, err)
+		}
+		written, err := ReadDefinitionsFile(path)
+		if err != nil {
+			t.Fatalf("Expected %v to be read back, got %v", name, err)
+		}
+		if !reflect.DeepEqual(written, definitions) {
+			t.Errorf("Expected %v to be read back as %+v, got %+v", name, definitions, written)
+		}
+	}
+}
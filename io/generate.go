@@ -0,0 +1,525 @@
+package io
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"strings"
+	"text/template"
+	"unicode"
+
+	"github.com/SaurabhJha/lexpar/lexer"
+	"github.com/SaurabhJha/lexpar/parser"
+)
+
+// characterNames spell out the characters of token types which cannot be in Go identifiers, so that the constant
+// of "+" is TokenPlus.
+var characterNames = map[rune]string{
+	'+': "Plus", '-': "Minus", '*': "Star", '/': "Slash", '%': "Percent", '^': "Caret", '=': "Equal",
+	'<': "Less", '>': "Greater", '!': "Bang", '?': "Question", '&': "Amp", '|': "Pipe", '~': "Tilde",
+	'(': "LParen", ')': "RParen", '[': "LBracket", ']': "RBracket", '{': "LBrace", '}': "RBrace",
+	',': "Comma", ';': "Semicolon", ':': "Colon", '.': "Dot", '#': "Hash", '@': "At", '$': "Dollar",
+	'\'': "Quote", '"': "DoubleQuote", '\\': "Backslash", '`': "Backquote",
+}
+
+// constantName returns the name of the Go constant of a token type, like TokenNumber for "number" and TokenPlus
+// for "+".
+func constantName(tokenType string) string {
+	var b strings.Builder
+	b.WriteString("Token")
+	upper := true
+	for _, r := range tokenType {
+		switch {
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			if upper {
+				r = unicode.ToUpper(r)
+			}
+			b.WriteRune(r)
+			upper = false
+		case characterNames[r] != "":
+			b.WriteString(characterNames[r])
+			upper = true
+		case r == '_' || unicode.IsSpace(r):
+			upper = true
+		default:
+			fmt.Fprintf(&b, "U%04X", r)
+			upper = true
+		}
+	}
+	return b.String()
+}
+
+type generatedToken struct {
+	Name     string
+	Constant string
+	Skip     bool
+}
+
+// generatedProduction is a production of the generated parser. Rule tells how its value is computed when it has
+// no action, like Parser.ParseValue does.
+type generatedProduction struct {
+	Name     string
+	Head     int
+	Length   int
+	Rule     string
+	Children []int
+}
+
+type generatedCode struct {
+	Package         string
+	Source          string
+	Tokens          []generatedToken
+	Transitions     [][]lexer.Transition
+	LexerAccepts    []int
+	NonTerminals    []string
+	Productions     []generatedProduction
+	StartProduction int
+	Actions         [][]int
+	Gotos           [][]int
+	ParserAccepts   []bool
+}
+
+// GenerateParser writes the source of a Go package which tokenizes and parses like the definitions, with the
+// automata of the tokenizer and the parsing table written out as arrays, so that nothing is built at run time.
+// The package only depends on the standard library. Its parser computes values with actions like
+// parser.Parser.ParseValue, and stops at the first syntax error, so grammars with productions using the "error"
+// symbol are refused. Since no node is built, the root labels written like "$1", the attributes and the "leaf"
+// rules of the grammar are left out, and a warning is returned for each of them. Source is the name of the
+// definitions file, mentioned in the header of the code.
+func GenerateParser(definitions DefinitionsTable, packageName string, source string) ([]byte, []parser.Diagnostic, error) {
+	var tok lexer.Tokenizer
+	tok.Init(definitions.RegularExpressions)
+	var pars parser.Parser
+	if err := pars.InitWithTokenTypes(definitions.Grammar, definitions.tokenTypes()); err != nil {
+		return nil, nil, err
+	}
+	lexerTables, parserTables := tok.Tables(), pars.Tables()
+
+	code := generatedCode{
+		Package:      packageName,
+		Source:       source,
+		Transitions:  lexerTables.Transitions,
+		LexerAccepts: lexerTables.Accepts,
+	}
+
+	skip := make(map[string]bool)
+	for _, tokenType := range definitions.SkipTokens {
+		skip[tokenType] = true
+	}
+	terminalNumber := map[string]int{"$": len(lexerTables.TokenTypes)}
+	usedConstants := map[string]bool{"TokenEndOfInput": true}
+	for i, tokenType := range lexerTables.TokenTypes {
+		constant := constantName(tokenType)
+		if usedConstants[constant] {
+			constant = fmt.Sprintf("%v%v", constant, i)
+		}
+		usedConstants[constant] = true
+		code.Tokens = append(code.Tokens, generatedToken{tokenType, constant, skip[tokenType]})
+		terminalNumber[tokenType] = i
+	}
+
+	g := parserTables.Grammar
+	nonTerminalNumber := make(map[string]int)
+	for _, p := range g.Productions {
+		if _, ok := nonTerminalNumber[string(p.Head)]; !ok {
+			nonTerminalNumber[string(p.Head)] = len(code.NonTerminals)
+			code.NonTerminals = append(code.NonTerminals, string(p.Head))
+		}
+	}
+	warnings := make([]parser.Diagnostic, 0)
+	warn := func(production int, format string, arguments ...interface{}) {
+		warnings = append(warnings, parser.Diagnostic{
+			Severity:   parser.SeverityWarning,
+			Production: production,
+			Symbol:     g.Productions[production].Head,
+			Message:    fmt.Sprintf(format, arguments...),
+		})
+	}
+	for i, p := range g.Productions {
+		body := make([]string, len(p.Body))
+		for j, s := range p.Body {
+			body[j] = string(s)
+		}
+		generated := generatedProduction{
+			Name:   strings.TrimSpace(string(p.Head) + " -> " + strings.Join(body, " ")),
+			Head:   nonTerminalNumber[string(p.Head)],
+			Length: len(p.Body),
+			Rule:   "ruleCopy",
+		}
+		for _, s := range body {
+			if s == "error" {
+				return nil, nil, fmt.Errorf("%v uses the error symbol, but the generated parser does not recover "+
+					"from errors", generated.Name)
+			}
+		}
+		if p.Rule.Type == "leaf" {
+			warn(i, "leaf rule of %v is generated as a copy of its child", generated.Name)
+		} else if strings.HasPrefix(p.Rule.RootLabel, "$") {
+			warn(i, "root label %v of the rule of %v is not generated", p.Rule.RootLabel, generated.Name)
+		}
+		if len(p.Rule.Attributes) > 0 {
+			warn(i, "attributes of the rule of %v are not generated", generated.Name)
+		}
+		switch {
+		case p.Rule.Type == "tree":
+			generated.Rule, generated.Children = "ruleTree", p.Rule.Children
+		case p.Rule.Type == "append":
+			generated.Rule, generated.Children = "ruleAppend", p.Rule.Children
+		case len(p.Rule.Children) > 0:
+			generated.Children = p.Rule.Children[:1]
+		case len(p.Body) > 0:
+			generated.Children = []int{0}
+		}
+		code.Productions = append(code.Productions, generated)
+		if p.Head == g.Start {
+			code.StartProduction = i
+		}
+	}
+
+	// The "error" symbol has no column, since no production uses it.
+	for _, moves := range parserTables.States {
+		actions := make([]int, len(terminalNumber))
+		gotos := make([]int, len(code.NonTerminals))
+		for i := range gotos {
+			gotos[i] = -1
+		}
+		accepts := false
+		for symbol, move := range moves {
+			if nonTerminal, ok := nonTerminalNumber[symbol]; ok {
+				gotos[nonTerminal] = move.Number
+				continue
+			}
+			terminal, ok := terminalNumber[symbol]
+			if !ok {
+				continue
+			}
+			switch move.Type {
+			case "shift":
+				actions[terminal] = move.Number + 1
+			case "reduce":
+				actions[terminal] = -move.Number - 1
+			case "accept":
+				accepts = true
+			}
+		}
+		code.Actions = append(code.Actions, actions)
+		code.Gotos = append(code.Gotos, gotos)
+		code.ParserAccepts = append(code.ParserAccepts, accepts)
+	}
+
+	var b bytes.Buffer
+	if err := generatedCodeTemplate.Execute(&b, code); err != nil {
+		return nil, nil, err
+	}
+	formatted, err := format.Source(b.Bytes())
+	if err != nil {
+		return nil, nil, err
+	}
+	return formatted, warnings, nil
+}
+
+var generatedCodeTemplate = template.Must(template.New("code").Parse(`// Code generated by lexpar generate from {{.Source}}. DO NOT EDIT.
+
+package {{.Package}}
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// TokenType is the type of a token.
+type TokenType int
+
+// The token types, in the order of their definitions.
+const (
+{{- range $i, $t := .Tokens}}
+	{{$t.Constant}} TokenType = {{$i}} // {{printf "%q" $t.Name}}
+{{- end}}
+	// TokenEndOfInput is the type of the token which the parser gets after the last one.
+	TokenEndOfInput TokenType = {{len .Tokens}}
+)
+
+var tokenTypeNames = [...]string{
+{{- range .Tokens}}
+	{{printf "%q" .Name}},
+{{- end}}
+	"$",
+}
+
+func (t TokenType) String() string {
+	return tokenTypeNames[t]
+}
+
+var skipped = [...]bool{
+{{- range .Tokens}}
+	{{.Skip}},
+{{- end}}
+}
+
+// Position is a location in a program text. Offset is counted in bytes from the start of the text, Line and
+// Column start at 1 and Column is counted in characters.
+type Position struct {
+	Offset int
+	Line   int
+	Column int
+}
+
+func (p Position) advance(text string) Position {
+	for _, character := range text {
+		if character == '\n' {
+			p.Line++
+			p.Column = 1
+		} else {
+			p.Column++
+		}
+	}
+	p.Offset += len(text)
+	return p
+}
+
+// Token is one "word" of a program text. Start is the position of its first character and End is the position
+// right after its last character.
+type Token struct {
+	Type   TokenType
+	Lexeme string
+	Start  Position
+	End    Position
+}
+
+// LexicalError is returned by Tokenize when some input is not matched by any regular expression.
+type LexicalError struct {
+	Position  Position
+	Character rune
+}
+
+func (e *LexicalError) Error() string {
+	return fmt.Sprintf("%d:%d: unexpected character %q", e.Position.Line, e.Position.Column, e.Character)
+}
+
+type transition struct {
+	low  rune
+	high rune
+	next int
+}
+
+// transitions[s] are the transitions of state s of the automata, sorted by character. State 0 is the start state.
+var transitions = [...][]transition{
+{{- range .Transitions}}
+	{ {{- range .}}{ {{- printf "%q" .Low}}, {{printf "%q" .High}}, {{.Next -}} }, {{end -}} },
+{{- end}}
+}
+
+// lexerAccepts[s] is the token type state s accepts, or -1.
+var lexerAccepts = [...]int{ {{- range .LexerAccepts}}{{.}}, {{end -}} }
+
+func nextState(s int, character rune) int {
+	row := transitions[s]
+	i := sort.Search(len(row), func(i int) bool { return row[i].high >= character })
+	if i < len(row) && row[i].low <= character {
+		return row[i].next
+	}
+	return -1
+}
+
+// Tokenize breaks up the input into the tokens of its longest matches, leaving out skipped tokens. If some of the
+// input is not matched, the returned error is a *LexicalError and the tokens are the ones found before it.
+func Tokenize(input string) ([]Token, error) {
+	tokens := make([]Token, 0, 100)
+	position := Position{0, 1, 1}
+	for len(input) != 0 {
+		s, length, tokenType := 0, 0, -1
+		for pos, character := range input {
+			if s = nextState(s, character); s < 0 {
+				break
+			}
+			if lexerAccepts[s] >= 0 {
+				length, tokenType = pos+utf8.RuneLen(character), lexerAccepts[s]
+			}
+		}
+		if tokenType < 0 {
+			character, _ := utf8.DecodeRuneInString(input)
+			return tokens, &LexicalError{position, character}
+		}
+		end := position.advance(input[:length])
+		if !skipped[tokenType] {
+			tokens = append(tokens, Token{TokenType(tokenType), input[:length], position, end})
+		}
+		input = input[length:]
+		position = end
+	}
+	return tokens, nil
+}
+
+type ruleType int
+
+const (
+	ruleCopy ruleType = iota
+	ruleTree
+	ruleAppend
+)
+
+type production struct {
+	head     int
+	length   int
+	rule     ruleType
+	children []int
+}
+
+var productionNames = [...]string{
+{{- range .Productions}}
+	{{printf "%q" .Name}},
+{{- end}}
+}
+
+var productions = [...]production{
+{{- range .Productions}}
+	{ {{- .Head}}, {{.Length}}, {{.Rule}}, []int{ {{- range $i, $c := .Children}}{{if $i}}, {{end}}{{$c}}{{end -}} } },
+{{- end}}
+}
+
+const startProduction = {{.StartProduction}}
+
+// parserActions[s][t] is the move of state s on token type t. A shift to state n is n+1, a reduction by
+// production n is -n-1 and 0 is a syntax error.
+var parserActions = [...][{{len .Tokens}} + 1]int{
+{{- range .Actions}}
+	{ {{- range $i, $a := .}}{{if $i}}, {{end}}{{$a}}{{end -}} },
+{{- end}}
+}
+
+// parserGotos[s][n] is the state reached from state s after reducing to non terminal n, or -1.
+var parserGotos = [...][{{len .NonTerminals}}]int{
+{{- range .Gotos}}
+	{ {{- range $i, $g := .}}{{if $i}}, {{end}}{{$g}}{{end -}} },
+{{- end}}
+}
+
+// parserAccepts[s] tells whether state s accepts at the end of the input.
+var parserAccepts = [...]bool{ {{- range .ParserAccepts}}{{.}}, {{end -}} }
+
+// ParseError is a token which cannot come after the tokens before it. Expected lists the token types that could
+// have come instead.
+type ParseError struct {
+	Token    Token
+	Expected []TokenType
+}
+
+func describeTokenType(t TokenType) string {
+	if t == TokenEndOfInput {
+		return "end of input"
+	}
+	return t.String()
+}
+
+func (e *ParseError) Error() string {
+	expected := make([]string, len(e.Expected))
+	for i, t := range e.Expected {
+		expected[i] = describeTokenType(t)
+	}
+	unexpected := describeTokenType(e.Token.Type)
+	if e.Token.Type != TokenEndOfInput && e.Token.Type.String() != e.Token.Lexeme {
+		unexpected = fmt.Sprintf("%v %q", e.Token.Type, e.Token.Lexeme)
+	}
+	return fmt.Sprintf("%d:%d: unexpected %v, expected %v",
+		e.Token.Start.Line, e.Token.Start.Column, unexpected, strings.Join(expected, ", "))
+}
+
+// Action computes the value of a production from the values of the symbols of its body, in body order. The value
+// of a token is its Token.
+type Action func(values []interface{}) interface{}
+
+// Parser parses tokens and computes a value per production with its actions.
+type Parser struct {
+	actions map[int]Action
+}
+
+// SetAction sets the action run on reducing a production, written like "expr -> expr + term". A production
+// without an action takes the value of the child its rule copies, or a []interface{} of the values of its
+// children for "tree" and "append" rules.
+func (p *Parser) SetAction(production string, action Action) error {
+	for i, name := range productionNames {
+		if name == production {
+			if p.actions == nil {
+				p.actions = make(map[int]Action)
+			}
+			p.actions[i] = action
+			return nil
+		}
+	}
+	return fmt.Errorf("grammar has no production %v", production)
+}
+
+func (p *Parser) reduce(number int, values []interface{}) interface{} {
+	if action, ok := p.actions[number]; ok {
+		return action(values)
+	}
+	prod := productions[number]
+	switch prod.rule {
+	case ruleTree:
+		list := make([]interface{}, 0, len(prod.children))
+		for _, child := range prod.children {
+			list = append(list, values[child])
+		}
+		return list
+	case ruleAppend:
+		list, ok := values[prod.children[0]].([]interface{})
+		if !ok {
+			list = []interface{}{values[prod.children[0]]}
+		}
+		for _, child := range prod.children[1:] {
+			list = append(list, values[child])
+		}
+		return list
+	}
+	if len(prod.children) > 0 {
+		return values[prod.children[0]]
+	}
+	return nil
+}
+
+// Parse parses tokens and returns the value of the start symbol. If the tokens are not a sentence of the grammar,
+// the returned error is a *ParseError for the first token which cannot be parsed.
+func (p *Parser) Parse(tokens []Token) (interface{}, error) {
+	end := Position{Offset: 0, Line: 1, Column: 1}
+	if len(tokens) > 0 {
+		end = tokens[len(tokens)-1].End
+	}
+	tokens = append(tokens, Token{TokenEndOfInput, "$", end, end})
+
+	states := []int{0}
+	values := make([]interface{}, 0)
+	for i := 0; ; {
+		token, s := tokens[i], states[len(states)-1]
+		if token.Type == TokenEndOfInput && parserAccepts[s] {
+			// The parser accepts instead of reducing by the production of the start symbol.
+			length := productions[startProduction].length
+			return p.reduce(startProduction, values[len(values)-length:]), nil
+		}
+
+		switch move := parserActions[s][token.Type]; {
+		case move > 0:
+			states = append(states, move-1)
+			values = append(values, token)
+			i++
+		case move < 0:
+			number := -move - 1
+			length := productions[number].length
+			body := make([]interface{}, length)
+			copy(body, values[len(values)-length:])
+			states, values = states[:len(states)-length], values[:len(values)-length]
+			values = append(values, p.reduce(number, body))
+			states = append(states, parserGotos[states[len(states)-1]][productions[number].head])
+		default:
+			expected := make([]TokenType, 0)
+			for t, move := range parserActions[s] {
+				if move != 0 || TokenType(t) == TokenEndOfInput && parserAccepts[s] {
+					expected = append(expected, TokenType(t))
+				}
+			}
+			return nil, &ParseError{token, expected}
+		}
+	}
+}
+`))
@@ -0,0 +1,241 @@
+package io
+
+import (
+	"fmt"
+	goparser "go/parser"
+	"go/token"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/SaurabhJha/lexpar/lexer"
+	"github.com/SaurabhJha/lexpar/parser"
+)
+
+func TestConstantName(t *testing.T) {
+	var testData = []struct {
+		tokenType    string
+		expectedName string
+	}{
+		{"number", "TokenNumber"},
+		{"+", "TokenPlus"},
+		{"==", "TokenEqualEqual"},
+		{"string_literal", "TokenStringLiteral"},
+		{"%token", "TokenPercentToken"},
+		{"é", "TokenÉ"},
+		{"→", "TokenU2192"},
+	}
+
+	for _, test := range testData {
+		if got := constantName(test.tokenType); got != test.expectedName {
+			t.Errorf("Expected %v for %q, got %v", test.expectedName, test.tokenType, got)
+		}
+	}
+}
+
+// calcProgram evaluates each argument with the generated calc package, where identifiers stand for their length,
+// and prints the value or the error of each.
+const calcProgram = `package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+
+	"gen/calc"
+)
+
+func main() {
+	var p calc.Parser
+	p.SetAction("expr -> expr + term", func(values []interface{}) interface{} {
+		return values[0].(int) + values[2].(int)
+	})
+	p.SetAction("term -> term * factor", func(values []interface{}) interface{} {
+		return values[0].(int) * values[2].(int)
+	})
+	p.SetAction("factor -> number", func(values []interface{}) interface{} {
+		n, _ := strconv.Atoi(values[0].(calc.Token).Lexeme)
+		return n
+	})
+	p.SetAction("factor -> id", func(values []interface{}) interface{} {
+		return len(values[0].(calc.Token).Lexeme)
+	})
+	for _, input := range os.Args[1:] {
+		tokens, err := calc.Tokenize(input)
+		if err != nil {
+			fmt.Println(err)
+			continue
+		}
+		value, err := p.Parse(tokens)
+		if err != nil {
+			fmt.Println(err)
+			continue
+		}
+		fmt.Println(value)
+	}
+}
+`
+
+// calcValues evaluates inputs like calcProgram does, with a tokenizer and a parser set up for the definitions.
+func calcValues(t *testing.T, definitions DefinitionsTable, inputs []string) string {
+	var tok lexer.Tokenizer
+	var pars parser.Parser
+	if err := CompileDefinitions(definitions, "", &tok, &pars); err != nil {
+		t.Fatalf("Expected definitions to compile, got %v", err)
+	}
+	pars.SetAction("expr", []string{"expr", "+", "term"}, func(values []interface{}) interface{} {
+		return values[0].(int) + values[2].(int)
+	})
+	pars.SetAction("term", []string{"term", "*", "factor"}, func(values []interface{}) interface{} {
+		return values[0].(int) * values[2].(int)
+	})
+	pars.SetAction("factor", []string{"number"}, func(values []interface{}) interface{} {
+		n, _ := strconv.Atoi(values[0].(lexer.Token).Lexeme)
+		return n
+	})
+	pars.SetAction("factor", []string{"id"}, func(values []interface{}) interface{} {
+		return len(values[0].(lexer.Token).Lexeme)
+	})
+
+	var b strings.Builder
+	for _, input := range inputs {
+		tokens, err := tok.Tokenize(input)
+		if err == nil {
+			var value interface{}
+			value, err = pars.ParseValue(tokens)
+			if err == nil {
+				fmt.Fprintln(&b, value)
+			}
+		}
+		if err != nil {
+			fmt.Fprintln(&b, err)
+		}
+		tok.Reset()
+		pars.Reset()
+	}
+	return b.String()
+}
+
+func TestGenerateParser(t *testing.T) {
+	definitions, err := ReadDefinitionsFile("../example.lexpar")
+	if err != nil {
+		t.Fatalf("Expected example.lexpar to be read, got %v", err)
+	}
+	code, warnings, err := GenerateParser(definitions, "calc", "example.lexpar")
+	if err != nil {
+		t.Fatalf("Expected code to be generated, got %v", err)
+	}
+	if len(warnings) > 0 {
+		t.Errorf("Expected no warnings, got %v", warnings)
+	}
+
+	file, err := goparser.ParseFile(token.NewFileSet(), "calc.go", code, 0)
+	if err != nil {
+		t.Fatalf("Expected generated code to be valid Go, got %v", err)
+	}
+	if file.Name.Name != "calc" || len(file.Imports) != 4 {
+		t.Errorf("Expected package calc importing 4 packages of the standard library, got %v with %v imports",
+			file.Name.Name, len(file.Imports))
+	}
+	for _, expected := range []string{
+		"// Code generated by lexpar generate from example.lexpar. DO NOT EDIT.",
+		"TokenPlus       TokenType = 3  // \"+\"",
+		"\"expr -> expr + term\",",
+	} {
+		if !strings.Contains(string(code), expected) {
+			t.Errorf("Expected generated code to contain %q", expected)
+		}
+	}
+
+	// The generated package is built and run with a program evaluating expressions, which has to print what
+	// Parser.ParseValue computes with the same actions.
+	goTool, err := exec.LookPath("go")
+	if err != nil {
+		t.Skip("go is not installed, the generated code is not built")
+	}
+	dir, err := ioutil.TempDir("", "lexpar")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	files := map[string]string{
+		"go.mod":       "module gen\n\ngo 1.15\n",
+		"calc/calc.go": string(code),
+		"main.go":      calcProgram,
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	inputs := []string{"2 + x * (3 + 4)", "(1 + 2) * abc", "2 +", "", "2 ? 3"}
+	for _, args := range [][]string{{"build", "./..."}, {"vet", "./..."}, append([]string{"run", "."}, inputs...)} {
+		command := exec.Command(goTool, args...)
+		command.Dir = dir
+		output, err := command.CombinedOutput()
+		if err != nil {
+			t.Fatalf("Expected go %v to succeed on the generated code, got %v\n%s", args[0], err, output)
+		}
+		if args[0] != "run" {
+			continue
+		}
+		if expected := calcValues(t, definitions, inputs); string(output) != expected {
+			t.Errorf("Expected the generated parser to print\n%v\ngot\n%s", expected, output)
+		}
+	}
+}
+
+func TestGenerateParserDiagnostics(t *testing.T) {
+	var testData = []struct {
+		rules            string
+		expectedWarnings []string
+		expectedError    string
+	}{
+		{
+			`s' -> s ; s -> number { leaf "n" 0 } ;`,
+			[]string{"warning: leaf rule of s -> number is generated as a copy of its child"},
+			"",
+		},
+		{
+			`s' -> s ; s -> number "+" number { tree "$1" 0 2 kind="sum" } ;`,
+			[]string{
+				"warning: root label $1 of the rule of s -> number + number is not generated",
+				"warning: attributes of the rule of s -> number + number are not generated",
+			},
+			"",
+		},
+		{
+			`s' -> s ; s -> number | error ;`,
+			nil,
+			"s -> error uses the error symbol, but the generated parser does not recover from errors",
+		},
+	}
+
+	for _, test := range testData {
+		definitions, err := ParseLexpar("%token number \"[0-9]+\"\n%token \"+\" \"/+\"\n%start s'\n%%\n" + test.rules)
+		if err != nil {
+			t.Fatalf("Expected %v to be read, got %v", test.rules, err)
+		}
+		_, diagnostics, err := GenerateParser(definitions, "gen", "test.lexpar")
+		var warnings []string
+		for _, d := range diagnostics {
+			warnings = append(warnings, d.String())
+		}
+		if !reflect.DeepEqual(warnings, test.expectedWarnings) {
+			t.Errorf("Expected warnings %q for %v, got %q", test.expectedWarnings, test.rules, warnings)
+		}
+		if test.expectedError == "" && err != nil || test.expectedError != "" && (err == nil || err.Error() != test.expectedError) {
+			t.Errorf("Expected error %q for %v, got %v", test.expectedError, test.rules, err)
+		}
+	}
+}
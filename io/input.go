@@ -2,12 +2,12 @@ package io
 
 import (
 	"bufio"
-	"encoding/json"
 	"fmt"
 	"os"
 	"strings"
 
 	"github.com/SaurabhJha/lexpar/lexer"
+	"github.com/SaurabhJha/lexpar/parser"
 )
 
 // ReadFromStdin abstracts away all the handling of reading from STDIN.
@@ -35,6 +35,8 @@ func GetCommandType(input string) string {
 		return "persist"
 	case "print":
 		return "print"
+	case "concrete":
+		return "concrete"
 	default:
 		return "eval"
 	}
@@ -45,28 +47,48 @@ func GetCommandType(input string) string {
 func ExecuteRegexCommand(command string, definitions *DefinitionsTable) {
 	commandSlice := strings.SplitN(command, " ", 3)
 	regexType, regex := commandSlice[1], commandSlice[2]
-	definitions.RegularExpressions[regexType] = lexer.RegularExpression(regex)
+	definitions.RegularExpressions.Set(regexType, lexer.RegularExpression(regex))
 }
 
-// Persist takes current defintiions and persist it to disk, overwriting current contents.
-func Persist(definitions *DefinitionsTable) {
-	definitionsJSON, _ := json.MarshalIndent(*definitions, "", "	")
-	file, err := os.OpenFile("example.json", os.O_WRONLY, 0755)
-	fmt.Println(definitionsJSON, err)
-	_, err1 := file.Write(definitionsJSON)
-	fmt.Println(err1)
-	file.Close()
+// Persist writes the current definitions back to the file they were read from, in the format of that file.
+func Persist(definitions *DefinitionsTable, path string) {
+	if err := WriteDefinitionsFile(path, *definitions); err != nil {
+		fmt.Println(err)
+	}
 }
 
 // Print just prints out the definitions data structure
 func Print(definitions *DefinitionsTable) {
 	fmt.Println("Regular expressions")
-	for regexName, regex := range definitions.RegularExpressions {
-		fmt.Printf("  %s: %s\n", regexName, regex)
+	for _, definition := range definitions.RegularExpressions {
+		fmt.Printf("  %s: %s\n", definition.TokenType, definition.Regex)
 	}
+	fmt.Println("Skipped tokens: ", definitions.SkipTokens)
 	fmt.Println("Grammar")
 	fmt.Println("  Start symbol: ", definitions.Grammar.Start)
 	for _, production := range definitions.Grammar.Productions {
 		fmt.Printf("  %s -> %s\n", production.Head, production.Body)
 	}
 }
+
+// PrintConcreteTree prints a concrete syntax tree with a line per node, indented by its depth. Nodes of productions
+// show their head and production number, and nodes of tokens show their token type and lexeme.
+func PrintConcreteTree(cst parser.ConcreteSyntaxTree) {
+	if cst.Root < 0 {
+		return
+	}
+	printConcreteNode(cst, cst.Root, 0)
+}
+
+func printConcreteNode(cst parser.ConcreteSyntaxTree, node int, depth int) {
+	n := cst.Nodes[node]
+	indent := strings.Repeat("  ", depth)
+	if n.Production < 0 {
+		fmt.Printf("%s%s %q %d:%d\n", indent, n.Symbol, n.Token.Lexeme, n.Start.Line, n.Start.Column)
+		return
+	}
+	fmt.Printf("%s%s (production %d) %d:%d-%d:%d\n", indent, n.Symbol, n.Production, n.Start.Line, n.Start.Column, n.End.Line, n.End.Column)
+	for _, child := range n.Children {
+		printConcreteNode(cst, child, depth+1)
+	}
+}
@@ -0,0 +1,104 @@
+package io
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/SaurabhJha/lexpar/lexer"
+	"github.com/SaurabhJha/lexpar/parser"
+)
+
+// tablesVersion changes whenever the layout of saved tables does, so that older files are found stale.
+const tablesVersion = 1
+
+// CompiledTables are the automata of a tokenizer and the parsing table of a parser, saved so that they do not have
+// to be built again. Hash is the hash of the definitions they were built from.
+type CompiledTables struct {
+	Hash   string
+	Lexer  lexer.Tables
+	Parser parser.Tables
+}
+
+// ErrStaleTables is returned by LoadTables when the tables were built from other definitions.
+var ErrStaleTables = errors.New("tables were built from other definitions")
+
+// HashDefinitions returns a hash of definitions which changes whenever they do.
+func HashDefinitions(definitions DefinitionsTable) (string, error) {
+	definitionsJSON, err := json.Marshal(definitions)
+	if err != nil {
+		return "", err
+	}
+	hash := sha256.Sum256([]byte(fmt.Sprintf("lexpar tables %v\n%s", tablesVersion, definitionsJSON)))
+	return hex.EncodeToString(hash[:]), nil
+}
+
+// SaveTables writes the tables of a tokenizer and a parser set up for definitions to a JSON file.
+func SaveTables(path string, definitions DefinitionsTable, tok *lexer.Tokenizer, pars *parser.Parser) error {
+	hash, err := HashDefinitions(definitions)
+	if err != nil {
+		return err
+	}
+	tablesJSON, err := json.Marshal(CompiledTables{hash, tok.Tables(), pars.Tables()})
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, tablesJSON, 0644)
+}
+
+// LoadTables sets up a tokenizer and a parser with tables written by SaveTables. If the tables were built from
+// other definitions, the returned error is ErrStaleTables and nothing is set up.
+func LoadTables(path string, definitions DefinitionsTable, tok *lexer.Tokenizer, pars *parser.Parser) error {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var tables CompiledTables
+	if err := json.Unmarshal(content, &tables); err != nil {
+		return fmt.Errorf("%v: %v", path, err)
+	}
+	hash, err := HashDefinitions(definitions)
+	if err != nil {
+		return err
+	}
+	if tables.Hash != hash {
+		return ErrStaleTables
+	}
+
+	if err := pars.InitFromTables(tables.Parser); err != nil {
+		return fmt.Errorf("%v: %v", path, err)
+	}
+	if err := tok.InitFromTables(tables.Lexer); err != nil {
+		return fmt.Errorf("%v: %v", path, err)
+	}
+	tok.Skip(definitions.SkipTokens)
+	return nil
+}
+
+// CompileDefinitions sets up a tokenizer and a parser for definitions. If tablesPath is not empty, the tables are
+// loaded from it when they were saved for the same definitions, and otherwise built and saved to it.
+func CompileDefinitions(definitions DefinitionsTable, tablesPath string, tok *lexer.Tokenizer, pars *parser.Parser) error {
+	if tablesPath != "" {
+		err := LoadTables(tablesPath, definitions, tok, pars)
+		if err == nil {
+			return nil
+		}
+		if err != ErrStaleTables && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	tok.Init(definitions.RegularExpressions)
+	tok.Skip(definitions.SkipTokens)
+	if err := pars.InitWithTokenTypes(definitions.Grammar, definitions.tokenTypes()); err != nil {
+		return err
+	}
+	if tablesPath != "" {
+		return SaveTables(tablesPath, definitions, tok, pars)
+	}
+	return nil
+}
@@ -0,0 +1,64 @@
+package io
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/SaurabhJha/lexpar/lexer"
+	"github.com/SaurabhJha/lexpar/parser"
+)
+
+func TestSaveAndLoadTables(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lexpar")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "example.tables")
+
+	definitions, err := ReadDefinitionsFile("../example.lexpar")
+	if err != nil {
+		t.Fatalf("Expected example.lexpar to be read, got %v", err)
+	}
+	var builtTok, loadedTok lexer.Tokenizer
+	var builtPars, loadedPars parser.Parser
+	if err := CompileDefinitions(definitions, path, &builtTok, &builtPars); err != nil {
+		t.Fatalf("Expected definitions to compile, got %v", err)
+	}
+	if err := LoadTables(path, definitions, &loadedTok, &loadedPars); err != nil {
+		t.Fatalf("Expected tables to be loaded, got %v", err)
+	}
+
+	trees := make([]parser.SyntaxGraph, 0, 2)
+	for _, pair := range []struct {
+		tok  *lexer.Tokenizer
+		pars *parser.Parser
+	}{{&builtTok, &builtPars}, {&loadedTok, &loadedPars}} {
+		tokens, err := pair.tok.Tokenize("2 + x * (3 + 4)")
+		if err != nil {
+			t.Fatalf("Expected input to be tokenized, got %v", err)
+		}
+		tree, err := pair.pars.Parse(tokens)
+		if err != nil {
+			t.Fatalf("Expected input to be parsed, got %v", err)
+		}
+		trees = append(trees, tree)
+	}
+	if !reflect.DeepEqual(trees[0], trees[1]) {
+		t.Errorf("Expected the loaded tables to build the same tree, got %v and %v", trees[0], trees[1])
+	}
+
+	definitions.SkipTokens = nil
+	if err := LoadTables(path, definitions, &loadedTok, &loadedPars); err != ErrStaleTables {
+		t.Errorf("Expected tables of other definitions to be stale, got %v", err)
+	}
+	if err := CompileDefinitions(definitions, path, &loadedTok, &loadedPars); err != nil {
+		t.Fatalf("Expected definitions to compile, got %v", err)
+	}
+	if err := LoadTables(path, definitions, &loadedTok, &loadedPars); err != nil {
+		t.Errorf("Expected stale tables to be saved again, got %v", err)
+	}
+}
@@ -11,6 +11,24 @@ type nondeterministicFiniteAutomata struct {
 	final           state // Its guaranteed by the way we construct NFAs that we will have only one final state.
 	transitionGraph nondeterministicGraph
 	closureSets     map[state]setOfStates
+	// tags is only set on NFAs built by combineUsingTaggedUnion. It maps the final state of each of the
+	// combined NFAs to its position in the list of combined NFAs, and is used in place of final.
+	tags map[state]int
+}
+
+// getStates returns the states of the NFA, which are the start state, the final state and the states found on its
+// transitions.
+func (nfa *nondeterministicFiniteAutomata) getStates() setOfStates {
+	states := setOfStates{nfa.start: true, nfa.final: true}
+	for s, row := range nfa.transitionGraph {
+		states.add(s)
+		for _, ends := range row {
+			for _, e := range ends {
+				states.add(e)
+			}
+		}
+	}
+	return states
 }
 
 func (nfa *nondeterministicFiniteAutomata) init(input transitionLabel) {
@@ -64,6 +82,56 @@ func (nfa *nondeterministicFiniteAutomata) applyStar() {
 	nfa.final++
 }
 
+func (nfa *nondeterministicFiniteAutomata) applyPlus() {
+	nfa.incrementStatesBy(1)
+	nfa.transitionGraph.addTransition(nfa.start-1, nfa.start, "")
+	nfa.transitionGraph.addTransition(nfa.final, nfa.final+1, "")
+	nfa.transitionGraph.addTransition(nfa.final, nfa.start, "")
+	nfa.start--
+	nfa.final++
+}
+
+func (nfa *nondeterministicFiniteAutomata) applyOptional() {
+	nfa.incrementStatesBy(1)
+	nfa.transitionGraph.addTransition(nfa.start-1, nfa.start, "")
+	nfa.transitionGraph.addTransition(nfa.final, nfa.final+1, "")
+	nfa.transitionGraph.addTransition(nfa.start-1, nfa.final+1, "")
+	nfa.start--
+	nfa.final++
+}
+
+// combineUsingTaggedUnion builds the union of NFAs while remembering which of them each final state belongs
+// to. A lower tag means a higher priority.
+func combineUsingTaggedUnion(nfas []nondeterministicFiniteAutomata) nondeterministicFiniteAutomata {
+	var combined nondeterministicFiniteAutomata
+	combined.transitionGraph = make(nondeterministicGraph)
+	combined.closureSets = make(map[state]setOfStates)
+	combined.tags = make(map[state]int)
+
+	nextFreeState := state(1)
+	for i := range nfas {
+		nfa := nfas[i]
+		nfa.incrementStatesBy(nextFreeState)
+		combined.transitionGraph.merge(&nfa.transitionGraph)
+		combined.transitionGraph.addTransition(combined.start, nfa.start, "")
+		combined.tags[nfa.final] = i
+		nextFreeState = nfa.final + 1
+	}
+	combined.final = nextFreeState - 1
+	return combined
+}
+
+// getTag returns the highest priority tag among a set of states, or -1 if none of the states are tagged.
+func (nfa *nondeterministicFiniteAutomata) getTag(ss setOfStates) int {
+	tag := -1
+	for s := range ss {
+		if t, ok := nfa.tags[s]; ok && (tag < 0 || t < tag) {
+			tag = t
+		}
+	}
+	return tag
+}
+
 func (nfa *nondeterministicFiniteAutomata) constructClosureSet(s state) setOfStates {
 	if states, ok := nfa.closureSets[s]; ok {
 		return states
@@ -93,13 +161,22 @@ func (nfa *nondeterministicFiniteAutomata) getOutgoingTransitionLabels(ss setOfS
 func (nfa *nondeterministicFiniteAutomata) getNextDfaState(ss setOfStates, l transitionLabel) setOfStates {
 	nextStates := make(setOfStates)
 	for s := range ss {
-		for _, ns := range nfa.transitionGraph[s][l] {
-			nextStates.add(ns)
+		for tl, endStates := range nfa.transitionGraph[s] {
+			if tl == "" || !tl.covers(l) {
+				continue
+			}
+			for _, ns := range endStates {
+				nextStates.add(ns)
+			}
 		}
 	}
 
 	nextDfaState := make(setOfStates)
 	for s := range nextStates {
+		// Closures are closed under epsilon moves, so the closure of a state already added is already there.
+		if nextDfaState.has(s) {
+			continue
+		}
 		for o := range nfa.constructClosureSet(s) {
 			nextDfaState.add(o)
 		}
@@ -115,36 +192,49 @@ type deterministicFiniteAutomata struct {
 	transitionGraph deterministicGraph
 	dead            bool
 	accepted        bool
+	tags            map[state]int // Tags of final states when converted from a tagged NFA.
 }
 
 func (nfa *nondeterministicFiniteAutomata) convertToDfa() deterministicFiniteAutomata {
 	dfaGraph := make(deterministicGraph)
 	q := make(queue, 0, 100)
-	seen := make(seenStates, 0, 100)
+	var seen seenStates
 
 	dfaStartState := nfa.constructClosureSet(nfa.start)
 	q.enqueue(dfaStartState)
 	seen.add(dfaStartState)
 	for !q.empty() {
 		currentDfaState := q.dequeue()
-		for label := range nfa.getOutgoingTransitionLabels(currentDfaState) {
+		// Character classes on outgoing transitions may overlap, so we split them into disjoint labels to keep
+		// the resulting automata deterministic.
+		currentState, _ := seen.getStateNumber(currentDfaState)
+		for label := range partitionLabels(nfa.getOutgoingTransitionLabels(currentDfaState)) {
 			nextDfaState := nfa.getNextDfaState(currentDfaState, label)
-			if !seen.has(nextDfaState) {
+			nextState, isNew := seen.getStateNumber(nextDfaState)
+			if isNew {
 				q.enqueue(nextDfaState)
-				seen.add(nextDfaState)
 			}
-			dfaGraph.addTransition(seen.getStateNumber(currentDfaState), seen.getStateNumber(nextDfaState), label)
+			dfaGraph.addTransition(currentState, nextState, label)
 		}
 	}
 
 	finalStates := make(setOfStates)
-	for s := range seen {
-		if seen[s].has(nfa.final) {
+	var tags map[state]int
+	if nfa.tags != nil {
+		tags = make(map[state]int)
+	}
+	for s := range seen.sets {
+		if nfa.tags == nil {
+			if seen.sets[s].has(nfa.final) {
+				finalStates.add(state(s))
+			}
+		} else if tag := nfa.getTag(seen.sets[s]); tag >= 0 {
 			finalStates.add(state(s))
+			tags[state(s)] = tag
 		}
 	}
 
-	return deterministicFiniteAutomata{start: 0, final: finalStates, current: 0, transitionGraph: dfaGraph}
+	return deterministicFiniteAutomata{start: 0, final: finalStates, current: 0, transitionGraph: dfaGraph, tags: tags}
 }
 
 func (d *deterministicFiniteAutomata) move(input transitionLabel) {
@@ -152,15 +242,13 @@ func (d *deterministicFiniteAutomata) move(input transitionLabel) {
 		return
 	}
 
-	nextState, ok := d.transitionGraph[d.current][input]
+	nextState, ok := d.transitionGraph.getNextState(d.current, input)
 	if !ok {
 		d.dead, d.accepted = true, false
 		return
 	}
 	d.current = nextState
-	if d.final.has(d.current) {
-		d.accepted = true
-	}
+	d.accepted = d.final.has(d.current)
 }
 
 func (d *deterministicFiniteAutomata) reset() {
@@ -136,6 +136,66 @@ func TestNonDeterministicFiniteAutomataStar(t *testing.T) {
 	}
 }
 
+func TestNonDeterministicFiniteAutomataPlus(t *testing.T) {
+	var nfa nondeterministicFiniteAutomata
+	nfa.init("a")
+	nfa.applyPlus()
+
+	if nfa.start != 0 {
+		t.Errorf("Expected start state to be 0, got %v", nfa.start)
+	}
+	if nfa.final != 3 {
+		t.Errorf("Expected final state to be 3, got %v", nfa.final)
+	}
+
+	var testData = []struct {
+		s        state
+		t        transitionLabel
+		expected []state
+	}{
+		{0, "", []state{1}},
+		{1, "a", []state{2}},
+		{2, "", []state{3, 1}},
+	}
+
+	for _, test := range testData {
+		if got := nfa.transitionGraph[test.s][test.t]; !reflect.DeepEqual(got, test.expected) {
+			t.Errorf("On state %v and input %v, expected %v but got %v",
+				test.s, test.t, test.expected, got)
+		}
+	}
+}
+
+func TestNonDeterministicFiniteAutomataOptional(t *testing.T) {
+	var nfa nondeterministicFiniteAutomata
+	nfa.init("a")
+	nfa.applyOptional()
+
+	if nfa.start != 0 {
+		t.Errorf("Expected start state to be 0, got %v", nfa.start)
+	}
+	if nfa.final != 3 {
+		t.Errorf("Expected final state to be 3, got %v", nfa.final)
+	}
+
+	var testData = []struct {
+		s        state
+		t        transitionLabel
+		expected []state
+	}{
+		{0, "", []state{1, 3}},
+		{1, "a", []state{2}},
+		{2, "", []state{3}},
+	}
+
+	for _, test := range testData {
+		if got := nfa.transitionGraph[test.s][test.t]; !reflect.DeepEqual(got, test.expected) {
+			t.Errorf("On state %v and input %v, expected %v but got %v",
+				test.s, test.t, test.expected, got)
+		}
+	}
+}
+
 func TestNonDeterministicFiniteAutomataClosure(t *testing.T) {
 	var nfa1, nfa2 nondeterministicFiniteAutomata
 	nfa1.init("a")
@@ -289,6 +349,74 @@ func TestNonDeterministicFiniteAutomataConvertToDfa(t *testing.T) {
 	}
 }
 
+func TestNonDeterministicFiniteAutomataTaggedUnion(t *testing.T) {
+	var nfa1, nfa2 nondeterministicFiniteAutomata
+	nfa1.init("a")
+	nfa2.init("b")
+	nfa := combineUsingTaggedUnion([]nondeterministicFiniteAutomata{nfa1, nfa2})
+
+	if nfa.start != 0 {
+		t.Errorf("Expected start state to be 0, got %v", nfa.start)
+	}
+	if expected := map[state]int{2: 0, 4: 1}; !reflect.DeepEqual(nfa.tags, expected) {
+		t.Errorf("Expected tags to be %v, got %v", expected, nfa.tags)
+	}
+
+	var testData = []struct {
+		s        state
+		t        transitionLabel
+		expected []state
+	}{
+		{0, "", []state{1, 3}},
+		{1, "a", []state{2}},
+		{3, "b", []state{4}},
+	}
+
+	for _, test := range testData {
+		if got := nfa.transitionGraph[test.s][test.t]; !reflect.DeepEqual(got, test.expected) {
+			t.Errorf("On state %v and input %v, expected %v but got %v",
+				test.s, test.t, test.expected, got)
+		}
+	}
+}
+
+func TestNonDeterministicFiniteAutomataConvertTaggedToDfa(t *testing.T) {
+	regexes := []RegularExpression{"if", "[a-z]+", "[0-9]+"}
+	nfas := make([]nondeterministicFiniteAutomata, 0, len(regexes))
+	for _, regex := range regexes {
+		nfas = append(nfas, regex.compile())
+	}
+	nfa := combineUsingTaggedUnion(nfas)
+	dfa := nfa.convertToDfa()
+
+	var testData = []struct {
+		input       string
+		expectedTag int
+	}{
+		{"if", 0},
+		{"i", 1},
+		{"iff", 1},
+		{"x", 1},
+		{"42", 2},
+		{"4x", -1},
+		{"", -1},
+	}
+
+	for _, test := range testData {
+		dfa.reset()
+		for _, character := range test.input {
+			dfa.move(transitionLabel(character))
+		}
+		got := -1
+		if dfa.accepted {
+			got = dfa.tags[dfa.current]
+		}
+		if got != test.expectedTag {
+			t.Errorf("Expected tag of %q to be %v, got %v", test.input, test.expectedTag, got)
+		}
+	}
+}
+
 func TestDeterministicFiniteAutomataMove(t *testing.T) {
 	var testData = []struct {
 		inputRegex RegularExpression
@@ -304,6 +432,36 @@ func TestDeterministicFiniteAutomataMove(t *testing.T) {
 		{"a(b|c)*", "abccbbc", true},
 		{"a(b|c)*", "a", true},
 		{"a(b|c)*", "abccdfdf", false},
+		{"[a-z][a-z0-9_]*", "snake_case2", true},
+		{"[a-z][a-z0-9_]*", "2snake", false},
+		{"[^0-9]", "x", true},
+		{"[^0-9]", "5", false},
+		{"a.c", "abc", true},
+		{"a.c", "a\nc", false},
+		{"a/.c", "abc", false},
+		{"a/.c", "a.c", true},
+		{"(i|[a-z])(f|[a-z])*", "if", true},
+		{"(i|[a-z])(f|[a-z])*", "ixz", true},
+		{"[0-9]+", "", false},
+		{"[0-9]+", "2021", true},
+		{"-?[0-9]+", "-12", true},
+		{"-?[0-9]+", "12", true},
+		{"-?[0-9]+", "--12", false},
+		{"a*b", "aaab", true},
+		{"a+|b", "b", true},
+		{"(ab)+c?", "ababc", true},
+		{"(ab)+c?", "abba", false},
+		{"(ab)+", "aba", false},
+		{"x{3}", "xxx", true},
+		{"x{3}", "xx", false},
+		{"x{2,3}", "xxx", true},
+		{"x{2,3}", "xxxx", false},
+		{"x{2,}", "xxxxxx", true},
+		{"x{0,1}y", "y", true},
+		{"a/+", "a+", true},
+		{"a/?", "a?", true},
+		{"a/{2}", "a{2}", true},
+		{"{", "{", true},
 	}
 
 	for _, test := range testData {
@@ -317,3 +475,62 @@ func TestDeterministicFiniteAutomataMove(t *testing.T) {
 		}
 	}
 }
+
+func TestSetOfStatesKey(t *testing.T) {
+	forwards, backwards := make(setOfStates), make(setOfStates)
+	states := []state{3, 1, 300, 70000, 0}
+	for i := range states {
+		forwards.add(states[i])
+		backwards.add(states[len(states)-1-i])
+	}
+	if forwards.key() != backwards.key() {
+		t.Errorf("Expected sets built in different orders to have the same key, got %q and %q", forwards.key(), backwards.key())
+	}
+
+	other := setOfStates{3: true, 1: true, 300: true, 70001: true, 0: true}
+	if forwards.key() == other.key() {
+		t.Errorf("Expected different sets to have different keys, got %q for both", other.key())
+	}
+
+	var seen seenStates
+	first, isNew := seen.getStateNumber(forwards)
+	again, isNewAgain := seen.getStateNumber(backwards)
+	if !isNew || isNewAgain || first != again {
+		t.Errorf("Expected an equal set to get the same number, got %v (new %v) and %v (new %v)", first, isNew, again, isNewAgain)
+	}
+	if number, isNew := seen.getStateNumber(other); !isNew || number != 1 {
+		t.Errorf("Expected a new set to be numbered 1, got %v (new %v)", number, isNew)
+	}
+}
+
+// countDfaStates counts the states of the DFA of an NFA by subset construction, comparing sets directly rather
+// than by their keys.
+func countDfaStates(nfa nondeterministicFiniteAutomata) int {
+	sets := []setOfStates{nfa.constructClosureSet(nfa.start)}
+	for i := 0; i < len(sets); i++ {
+		for label := range partitionLabels(nfa.getOutgoingTransitionLabels(sets[i])) {
+			next := nfa.getNextDfaState(sets[i], label)
+			isNew := true
+			for _, set := range sets {
+				if reflect.DeepEqual(set, next) {
+					isNew = false
+					break
+				}
+			}
+			if isNew {
+				sets = append(sets, next)
+			}
+		}
+	}
+	return len(sets)
+}
+
+func TestConvertToDfaStates(t *testing.T) {
+	for _, regex := range []RegularExpression{"(a|b)*abb", "if|[a-z]+", "[0-9]+(.[0-9]+)?", "(a|b|c)(a|b|c)*"} {
+		nfa := regex.compile()
+		dfa := nfa.convertToDfa()
+		if expected, got := countDfaStates(nfa), len(dfa.getStates()); got != expected {
+			t.Errorf("Expected the DFA of %v to have %v states, got %v", regex, expected, got)
+		}
+	}
+}
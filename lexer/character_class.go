@@ -0,0 +1,245 @@
+package lexer
+
+import (
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// characterRange is an inclusive range of characters.
+type characterRange struct {
+	low  rune
+	high rune
+}
+
+// characterClass is a set of characters stored as sorted, non overlapping ranges. A class like [a-z] becomes a
+// single NFA transition instead of a union of 26 transitions.
+type characterClass []characterRange
+
+// anyCharacter is the class matched by the `.` wildcard. Like most regex engines, it does not match newlines.
+var anyCharacter = characterClass{{0, '\n' - 1}, {'\n' + 1, utf8.MaxRune}}
+
+func (c characterClass) normalize() characterClass {
+	sorted := make(characterClass, len(c))
+	copy(sorted, c)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].low < sorted[j].low })
+
+	normalized := make(characterClass, 0, len(sorted))
+	for _, cr := range sorted {
+		last := len(normalized) - 1
+		if last >= 0 && cr.low <= normalized[last].high+1 {
+			if cr.high > normalized[last].high {
+				normalized[last].high = cr.high
+			}
+			continue
+		}
+		normalized = append(normalized, cr)
+	}
+	return normalized
+}
+
+// negate assumes that the class is normalized.
+func (c characterClass) negate() characterClass {
+	negated := make(characterClass, 0, len(c)+1)
+	var next rune
+	for _, cr := range c {
+		if cr.low > next {
+			negated = append(negated, characterRange{next, cr.low - 1})
+		}
+		next = cr.high + 1
+	}
+	if next <= utf8.MaxRune {
+		negated = append(negated, characterRange{next, utf8.MaxRune})
+	}
+	return negated
+}
+
+func (c characterClass) contains(r rune) bool {
+	i := sort.Search(len(c), func(i int) bool { return c[i].high >= r })
+	return i < len(c) && c[i].low <= r
+}
+
+// label encodes a normalized class as a transition label. A class with a single character is labelled by that
+// character, so that it behaves exactly like a plain character transition. Any other class is written as
+// "[" followed by a "low-high" triple per range and "]", which can never clash with a single character label.
+func (c characterClass) label() transitionLabel {
+	if len(c) == 1 && c[0].low == c[0].high {
+		return transitionLabel(string(c[0].low))
+	}
+
+	var b strings.Builder
+	b.WriteRune('[')
+	for _, cr := range c {
+		b.WriteRune(cr.low)
+		b.WriteRune('-')
+		b.WriteRune(cr.high)
+	}
+	b.WriteRune(']')
+	return transitionLabel(b.String())
+}
+
+func (l transitionLabel) isClass() bool {
+	return utf8.RuneCountInString(string(l)) > 1
+}
+
+func (l transitionLabel) class() characterClass {
+	if !l.isClass() {
+		r, _ := utf8.DecodeRuneInString(string(l))
+		return characterClass{{r, r}}
+	}
+
+	runes := []rune(string(l[1 : len(l)-1]))
+	c := make(characterClass, 0, len(runes)/3)
+	for i := 0; i+2 < len(runes); i += 3 {
+		c = append(c, characterRange{runes[i], runes[i+2]})
+	}
+	return c
+}
+
+// contains tells whether a character is matched by the label. Unlike class().contains, it does not allocate,
+// which matters since it runs for every input character.
+func (l transitionLabel) contains(r rune) bool {
+	if !l.isClass() {
+		c, _ := utf8.DecodeRuneInString(string(l))
+		return c == r
+	}
+
+	ranges := string(l[1 : len(l)-1])
+	for len(ranges) > 0 {
+		low, lowSize := utf8.DecodeRuneInString(ranges)
+		_, dashSize := utf8.DecodeRuneInString(ranges[lowSize:])
+		high, highSize := utf8.DecodeRuneInString(ranges[lowSize+dashSize:])
+		if low <= r && r <= high {
+			return true
+		}
+		ranges = ranges[lowSize+dashSize+highSize:]
+	}
+	return false
+}
+
+// covers tells whether every character matched by o is also matched by l.
+func (l transitionLabel) covers(o transitionLabel) bool {
+	if l == o {
+		return true
+	}
+	if !l.isClass() || o == "" {
+		return false
+	}
+
+	c := l.class()
+	for _, cr := range o.class() {
+		i := sort.Search(len(c), func(i int) bool { return c[i].high >= cr.low })
+		if i == len(c) || c[i].low > cr.low || c[i].high < cr.high {
+			return false
+		}
+	}
+	return true
+}
+
+// partitionLabels splits a set of possibly overlapping labels into disjoint labels such that each of the
+// resulting labels is either fully inside or fully outside every input label. Characters that are matched by
+// the same input labels are grouped under one resulting label.
+func partitionLabels(labels setOfTransitionLables) setOfTransitionLables {
+	hasClass := false
+	for l := range labels {
+		if l.isClass() {
+			hasClass = true
+			break
+		}
+	}
+	if !hasClass {
+		// Single character labels are already disjoint.
+		return labels
+	}
+
+	classes := make([]characterClass, 0, len(labels))
+	boundaries := make([]rune, 0, 2*len(labels))
+	for l := range labels {
+		c := l.class()
+		classes = append(classes, c)
+		for _, cr := range c {
+			boundaries = append(boundaries, cr.low, cr.high+1)
+		}
+	}
+	sort.Slice(boundaries, func(i, j int) bool { return boundaries[i] < boundaries[j] })
+
+	groups := make(map[string]characterClass)
+	for i := 0; i+1 < len(boundaries); i++ {
+		low, high := boundaries[i], boundaries[i+1]-1
+		if low > high {
+			continue
+		}
+		signature := make([]byte, len(classes))
+		covered := false
+		for j, c := range classes {
+			signature[j] = '0'
+			if c.contains(low) {
+				signature[j] = '1'
+				covered = true
+			}
+		}
+		if covered {
+			groups[string(signature)] = append(groups[string(signature)], characterRange{low, high})
+		}
+	}
+
+	partition := make(setOfTransitionLables)
+	for _, c := range groups {
+		partition.add(c.normalize().label())
+	}
+	return partition
+}
+
+// parseCharacterClass parses a bracket expression like [a-z0-9_] or [^"] into a normalized class. The second
+// return value is false if the bracket expression is malformed.
+func parseCharacterClass(expression string) (characterClass, bool) {
+	if len(expression) < 2 || expression[0] != '[' || expression[len(expression)-1] != ']' {
+		return nil, false
+	}
+
+	runes := []rune(expression[1 : len(expression)-1])
+	negated := len(runes) > 0 && runes[0] == '^'
+	if negated {
+		runes = runes[1:]
+	}
+
+	// Resolve escapes first so that ranges can be read off pairs of (character, escaped) values.
+	characters := make([]rune, 0, len(runes))
+	escaped := make([]bool, 0, len(runes))
+	for i := 0; i < len(runes); i++ {
+		if runes[i] == '/' {
+			if i+1 == len(runes) {
+				return nil, false
+			}
+			i++
+			characters = append(characters, runes[i])
+			escaped = append(escaped, true)
+		} else {
+			characters = append(characters, runes[i])
+			escaped = append(escaped, false)
+		}
+	}
+	if len(characters) == 0 {
+		return nil, false
+	}
+
+	c := make(characterClass, 0, len(characters))
+	for i := 0; i < len(characters); i++ {
+		isRange := i+2 < len(characters) && characters[i+1] == '-' && !escaped[i+1]
+		if !isRange {
+			c = append(c, characterRange{characters[i], characters[i]})
+			continue
+		}
+		if characters[i] > characters[i+2] {
+			return nil, false
+		}
+		c = append(c, characterRange{characters[i], characters[i+2]})
+		i += 2
+	}
+
+	c = c.normalize()
+	if negated {
+		c = c.negate()
+	}
+	return c, true
+}
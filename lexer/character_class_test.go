@@ -0,0 +1,168 @@
+package lexer
+
+import (
+	"reflect"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestCharacterClassNormalize(t *testing.T) {
+	var testData = []struct {
+		input    characterClass
+		expected characterClass
+	}{
+		{characterClass{{'a', 'z'}, {'0', '9'}}, characterClass{{'0', '9'}, {'a', 'z'}}},
+		{characterClass{{'a', 'f'}, {'c', 'k'}}, characterClass{{'a', 'k'}}},
+		{characterClass{{'a', 'c'}, {'d', 'f'}}, characterClass{{'a', 'f'}}},
+		{characterClass{{'x', 'x'}, {'a', 'z'}}, characterClass{{'a', 'z'}}},
+	}
+
+	for _, test := range testData {
+		if got := test.input.normalize(); !reflect.DeepEqual(got, test.expected) {
+			t.Errorf("Expected %v.normalize() = %v, got %v", test.input, test.expected, got)
+		}
+	}
+}
+
+func TestCharacterClassNegate(t *testing.T) {
+	var testData = []struct {
+		input    characterClass
+		expected characterClass
+	}{
+		{characterClass{{'b', 'y'}}, characterClass{{0, 'a'}, {'z', utf8.MaxRune}}},
+		{characterClass{{0, 'a'}}, characterClass{{'b', utf8.MaxRune}}},
+		{characterClass{{0, utf8.MaxRune}}, characterClass{}},
+		{anyCharacter, characterClass{{'\n', '\n'}}},
+	}
+
+	for _, test := range testData {
+		if got := test.input.negate(); !reflect.DeepEqual(got, test.expected) {
+			t.Errorf("Expected %v.negate() = %v, got %v", test.input, test.expected, got)
+		}
+	}
+}
+
+func TestCharacterClassLabel(t *testing.T) {
+	var testData = []struct {
+		input    characterClass
+		expected transitionLabel
+	}{
+		{characterClass{{'a', 'a'}}, "a"},
+		{characterClass{{'[', '['}}, "["},
+		{characterClass{{'a', 'z'}}, "[a-z]"},
+		{characterClass{{'0', '9'}, {'a', 'a'}}, "[0-9a-a]"},
+	}
+
+	for _, test := range testData {
+		got := test.input.label()
+		if got != test.expected {
+			t.Errorf("Expected %v.label() = %v, got %v", test.input, test.expected, got)
+		}
+		if class := got.class(); !reflect.DeepEqual(class, test.input) {
+			t.Errorf("Expected %v.class() = %v, got %v", got, test.input, class)
+		}
+	}
+}
+
+func TestTransitionLabelContains(t *testing.T) {
+	var testData = []struct {
+		label    transitionLabel
+		input    rune
+		expected bool
+	}{
+		{"a", 'a', true},
+		{"a", 'b', false},
+		{"é", 'é', true},
+		{"[a-z]", 'q', true},
+		{"[0-9a-z]", '5', true},
+		{"[0-9a-z]", '_', false},
+		{"[a-aé-ü]", 'ö', true},
+		{"[]", 'a', false},
+	}
+
+	for _, test := range testData {
+		if got := test.label.contains(test.input); got != test.expected {
+			t.Errorf("Expected %v.contains(%q) = %v, got %v", test.label, test.input, test.expected, got)
+		}
+	}
+}
+
+func TestTransitionLabelCovers(t *testing.T) {
+	var testData = []struct {
+		label    transitionLabel
+		other    transitionLabel
+		expected bool
+	}{
+		{"a", "a", true},
+		{"a", "b", false},
+		{"[a-z]", "q", true},
+		{"[a-z]", "[c-f]", true},
+		{"[a-z]", "[0-9c-f]", false},
+		{"[0-9a-z]", "[0-9c-f]", true},
+		{"[a-z]", "", false},
+	}
+
+	for _, test := range testData {
+		if got := test.label.covers(test.other); got != test.expected {
+			t.Errorf("Expected %v.covers(%v) = %v, got %v", test.label, test.other, test.expected, got)
+		}
+	}
+}
+
+func TestPartitionLabels(t *testing.T) {
+	var testData = []struct {
+		input    setOfTransitionLables
+		expected setOfTransitionLables
+	}{
+		{
+			setOfTransitionLables{"a": true, "b": true},
+			setOfTransitionLables{"a": true, "b": true},
+		},
+		{
+			setOfTransitionLables{"[a-z]": true, "i": true},
+			setOfTransitionLables{"[a-hj-z]": true, "i": true},
+		},
+		{
+			setOfTransitionLables{"[a-m]": true, "[h-z]": true},
+			setOfTransitionLables{"[a-g]": true, "[h-m]": true, "[n-z]": true},
+		},
+		{
+			setOfTransitionLables{"[a-cx-z]": true, "[0-9]": true},
+			setOfTransitionLables{"[a-cx-z]": true, "[0-9]": true},
+		},
+	}
+
+	for _, test := range testData {
+		if got := partitionLabels(test.input); !reflect.DeepEqual(got, test.expected) {
+			t.Errorf("Expected partitionLabels(%v) = %v, got %v", test.input, test.expected, got)
+		}
+	}
+}
+
+func TestParseCharacterClass(t *testing.T) {
+	var testData = []struct {
+		input         string
+		expected      characterClass
+		expectedValid bool
+	}{
+		{"[a-z]", characterClass{{'a', 'z'}}, true},
+		{"[a-z0-9_]", characterClass{{'0', '9'}, {'_', '_'}, {'a', 'z'}}, true},
+		{"[-a]", characterClass{{'-', '-'}, {'a', 'a'}}, true},
+		{"[a/-z]", characterClass{{'-', '-'}, {'a', 'a'}, {'z', 'z'}}, true},
+		{"[/]/^]", characterClass{{']', '^'}}, true},
+		{"[^\"\n]", characterClass{{0, '\t'}, {'\v', '!'}, {'#', utf8.MaxRune}}, true},
+		{"[z-a]", nil, false},
+		{"[]", nil, false},
+		{"[a/]", nil, false},
+	}
+
+	for _, test := range testData {
+		got, valid := parseCharacterClass(test.input)
+		if valid != test.expectedValid {
+			t.Errorf("Expected validity of %q to be %v, got %v", test.input, test.expectedValid, valid)
+		}
+		if valid && !reflect.DeepEqual(got, test.expected) {
+			t.Errorf("Expected parseCharacterClass(%q) = %v, got %v", test.input, test.expected, got)
+		}
+	}
+}
@@ -1,6 +1,9 @@
 package lexer
 
-import "reflect"
+import (
+	"sort"
+	"unicode/utf8"
+)
 
 type stack []byte
 
@@ -78,6 +81,15 @@ func (st *setOfTransitionLables) add(l transitionLabel) {
 	(*st)[l] = true
 }
 
+func (st setOfTransitionLables) sorted() []transitionLabel {
+	labels := make([]transitionLabel, 0, len(st))
+	for l := range st {
+		labels = append(labels, l)
+	}
+	sort.Slice(labels, func(i, j int) bool { return labels[i] < labels[j] })
+	return labels
+}
+
 type queue []setOfStates
 
 func (q *queue) enqueue(s setOfStates) {
@@ -103,27 +115,73 @@ func (d *deterministicGraph) addTransition(s state, e state, l transitionLabel)
 	(*d)[s][l] = e
 }
 
-type seenStates []setOfStates
+// getNextState looks up the transition on a single character input. Labels on outgoing transitions of a state
+// are disjoint, so at most one of them matches.
+func (d *deterministicGraph) getNextState(s state, input transitionLabel) (state, bool) {
+	row := (*d)[s]
+	if e, ok := row[input]; ok {
+		return e, true
+	}
+
+	r, _ := utf8.DecodeRuneInString(string(input))
+	for l, e := range row {
+		if l.isClass() && l.contains(r) {
+			return e, true
+		}
+	}
+	return 0, false
+}
+
+// sortedStates implements sort.Interface directly since sorting states is on the hot path of subset
+// construction.
+type sortedStates []state
+
+func (s sortedStates) Len() int           { return len(s) }
+func (s sortedStates) Less(i, j int) bool { return s[i] < s[j] }
+func (s sortedStates) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+
+// key returns a string which is the same for two sets if and only if they contain the same states. It is made
+// of the sorted states, four bytes each.
+func (ss *setOfStates) key() string {
+	states := make(sortedStates, 0, len(*ss))
+	for s := range *ss {
+		states = append(states, s)
+	}
+	sort.Sort(states)
+
+	key := make([]byte, 0, 4*len(states))
+	for _, s := range states {
+		key = append(key, byte(s>>24), byte(s>>16), byte(s>>8), byte(s))
+	}
+	return string(key)
+}
+
+// seenStates numbers the sets of NFA states found during subset construction. Sets are looked up by their key,
+// so that finding a set does not depend on how many sets have been seen.
+type seenStates struct {
+	sets    []setOfStates
+	numbers map[string]state
+}
 
 func (s *seenStates) add(ss setOfStates) {
-	*s = append(*s, ss)
+	s.addWithKey(ss, ss.key())
 }
 
-func (s *seenStates) has(ss setOfStates) bool {
-	for i := range *s {
-		if reflect.DeepEqual((*s)[i], ss) {
-			return true
-		}
+func (s *seenStates) addWithKey(ss setOfStates, key string) {
+	if s.numbers == nil {
+		s.numbers = make(map[string]state)
 	}
-	return false
+	s.numbers[key] = state(len(s.sets))
+	s.sets = append(s.sets, ss)
 }
 
-func (s *seenStates) getStateNumber(ss setOfStates) state {
-	for i := range *s {
-		if reflect.DeepEqual((*s)[i], ss) {
-			return state(i)
-		}
+// getStateNumber returns the number of a set, numbering it first if it has not been seen before. The second
+// return value tells whether the set was new.
+func (s *seenStates) getStateNumber(ss setOfStates) (state, bool) {
+	key := ss.key()
+	if number, ok := s.numbers[key]; ok {
+		return number, false
 	}
-	*s = append(*s, ss)
-	return state(len(*s) - 1)
+	s.addWithKey(ss, key)
+	return state(len(s.sets) - 1), true
 }
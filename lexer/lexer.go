@@ -2,36 +2,216 @@ package lexer
 
 import (
 	"fmt"
-	"strings"
+	"sort"
+	"unicode/utf8"
 )
 
-// Token represents one "word" of a program text. A sequence of tokens are output by a tokenizer.
+// Position is a location in a program text. Offset is counted in bytes from the start of the text, Line and
+// Column start at 1 and Column is counted in characters.
+type Position struct {
+	Offset int
+	Line   int
+	Column int
+}
+
+func (p Position) advance(text string) Position {
+	for _, character := range text {
+		if character == '\n' {
+			p.Line++
+			p.Column = 1
+		} else {
+			p.Column++
+		}
+	}
+	p.Offset += len(text)
+	return p
+}
+
+// Token represents one "word" of a program text. A sequence of tokens are output by a tokenizer. Start is the
+// position of the first character of the token and End is the position right after its last character.
 type Token struct {
 	TokenType string
 	Lexeme    string
+	Start     Position
+	End       Position
 }
 
-// A Tokenizer object breaks up strings using a collection of regular expressions.
+// ErrorTokenType is the token type of tokens covering input that is not matched by any regular expression.
+// Such tokens are only produced after Tokenizer.EmitErrorTokens is turned on.
+const ErrorTokenType = "ERROR"
+
+// LexicalError is returned by Tokenize when some input is not matched by any regular expression.
+type LexicalError struct {
+	Position  Position
+	Character rune
+}
+
+func (e *LexicalError) Error() string {
+	return fmt.Sprintf("%d:%d: unexpected character %q", e.Position.Line, e.Position.Column, e.Character)
+}
+
+// A Tokenizer object breaks up strings using a collection of regular expressions. All the regular expressions
+// are compiled into a single automata whose accepting states are tagged with the token type they recognise, so
+// that the input is scanned only once per token.
 type Tokenizer struct {
-	automata map[string]deterministicFiniteAutomata
+	tokenTypes      []string
+	automata        deterministicFiniteAutomata
+	skip            map[string]bool
+	emitErrorTokens bool
+	statistics      Statistics
 }
 
-// Init sets up all the state required for Tokenizer to start processing strings.
-func (t *Tokenizer) Init(regexJSON map[string]RegularExpression) {
-	t.automata = make(map[string]deterministicFiniteAutomata)
-	for regexID, regex := range regexJSON {
+// Statistics describes the size of the automata built by Tokenizer.Init at each step of the compilation.
+type Statistics struct {
+	NfaStates          int
+	DfaStates          int
+	MinimizedDfaStates int
+}
+
+// Init sets up all the state required for Tokenizer to start processing strings. The order of definitions
+// decides which token type wins when several of them match the same longest prefix.
+func (t *Tokenizer) Init(definitions TokenDefinitions) {
+	t.tokenTypes = make([]string, 0, len(definitions))
+	nfas := make([]nondeterministicFiniteAutomata, 0, len(definitions))
+	for _, definition := range definitions {
+		regex := definition.Regex
 		if !regex.isValid() {
 			panic(fmt.Sprintf("Regex '%v' is invalid, aborting", regex))
 		}
-		nfa := regex.compile()
-		dfa := nfa.convertToDfa()
-		t.automata[regexID] = dfa
+		t.tokenTypes = append(t.tokenTypes, definition.TokenType)
+		nfas = append(nfas, regex.compile())
+	}
+	nfa := combineUsingTaggedUnion(nfas)
+	dfa := nfa.convertToDfa()
+	t.automata = dfa.minimize()
+	t.statistics = Statistics{
+		NfaStates:          len(nfa.getStates()),
+		DfaStates:          len(dfa.getStates()),
+		MinimizedDfaStates: len(t.automata.getStates()),
+	}
+}
+
+// Statistics returns the number of states of the automata built by Init, before and after minimization.
+func (t *Tokenizer) Statistics() Statistics {
+	return t.statistics
+}
+
+// Tables is the automata built by Init written out as plain data, like code generators need. States are numbered
+// from 0, which is the start state. Transitions[s] are the transitions of state s, sorted by character and without
+// overlaps, and Accepts[s] is the index in TokenTypes of the token type state s accepts, or -1.
+type Tables struct {
+	TokenTypes  []string
+	Transitions [][]Transition
+	Accepts     []int
+}
+
+// Transition goes to state Next on the characters from Low to High.
+type Transition struct {
+	Low  rune
+	High rune
+	Next int
+}
+
+// Tables returns the automata built by Init.
+func (t *Tokenizer) Tables() Tables {
+	states := t.automata.getStates()
+	number := make(map[state]int, len(states))
+	number[t.automata.start] = 0
+	for _, s := range states {
+		if s != t.automata.start {
+			number[s] = len(number)
+		}
+	}
+
+	tables := Tables{
+		TokenTypes:  append([]string(nil), t.tokenTypes...),
+		Transitions: make([][]Transition, len(states)),
+		Accepts:     make([]int, len(states)),
+	}
+	for _, s := range states {
+		transitions := make([]Transition, 0, len(t.automata.transitionGraph[s]))
+		for l, e := range t.automata.transitionGraph[s] {
+			for _, cr := range l.class() {
+				transitions = append(transitions, Transition{cr.low, cr.high, number[e]})
+			}
+		}
+		sort.Slice(transitions, func(i, j int) bool { return transitions[i].Low < transitions[j].Low })
+		tables.Transitions[number[s]] = transitions
+		tables.Accepts[number[s]] = -1
+		if t.automata.final.has(s) {
+			tables.Accepts[number[s]] = t.automata.tags[s]
+		}
 	}
+	return tables
 }
 
-func (t *Tokenizer) getMatchingPrefix(regexID string, input string) string {
-	dfa := t.automata[regexID]
-	acceptedAt := -1
+// InitFromTables sets up the tokenizer with an automata returned by Tables, without building it again. Skipped
+// token types are set with Skip as after Init, and Statistics only counts the states of the minimized automata. It
+// returns an error if a transition or an accepting state refers to a state or a token type the tables do not have.
+func (t *Tokenizer) InitFromTables(tables Tables) error {
+	if len(tables.Accepts) != len(tables.Transitions) {
+		return fmt.Errorf("tables have %v accepting token types for %v states", len(tables.Accepts), len(tables.Transitions))
+	}
+	for s, transitions := range tables.Transitions {
+		for _, transition := range transitions {
+			if transition.Next < 0 || transition.Next >= len(tables.Transitions) {
+				return fmt.Errorf("transition of state %v goes to state %v, which is out of range", s, transition.Next)
+			}
+			if transition.Low > transition.High {
+				return fmt.Errorf("transition of state %v has the empty range %q-%q", s, transition.Low, transition.High)
+			}
+		}
+		if tables.Accepts[s] < -1 || tables.Accepts[s] >= len(tables.TokenTypes) {
+			return fmt.Errorf("state %v accepts token type %v, which is out of range", s, tables.Accepts[s])
+		}
+	}
+
+	t.tokenTypes = append([]string(nil), tables.TokenTypes...)
+	graph := make(deterministicGraph)
+	final := make(setOfStates)
+	tags := make(map[state]int)
+	for s, transitions := range tables.Transitions {
+		// Ranges going to the same state make up one class, like the label they were written out from.
+		classes := make(map[int]characterClass)
+		for _, transition := range transitions {
+			classes[transition.Next] = append(classes[transition.Next], characterRange{transition.Low, transition.High})
+		}
+		for next, c := range classes {
+			graph.addTransition(state(s), state(next), c.normalize().label())
+		}
+		if tables.Accepts[s] >= 0 {
+			final.add(state(s))
+			tags[state(s)] = tables.Accepts[s]
+		}
+	}
+	t.automata = deterministicFiniteAutomata{start: 0, final: final, current: 0, transitionGraph: graph, tags: tags}
+	t.statistics = Statistics{MinimizedDfaStates: len(tables.Transitions)}
+	return nil
+}
+
+// Skip marks token types which are matched like any other token but are left out of the output of Tokenize.
+// It is meant for things like whitespace and comments.
+func (t *Tokenizer) Skip(tokenTypes []string) {
+	t.skip = make(map[string]bool)
+	for _, tokenType := range tokenTypes {
+		t.skip[tokenType] = true
+	}
+}
+
+// EmitErrorTokens changes how Tokenize deals with input that is not matched by any regular expression. By
+// default, tokenizing stops at the first such character. With error tokens turned on, every run of unmatched
+// characters becomes a token of type ErrorTokenType and tokenizing resumes at the next character that starts a
+// match.
+func (t *Tokenizer) EmitErrorTokens(emit bool) {
+	t.emitErrorTokens = emit
+}
+
+// getMaxMatchingPrefix returns the longest prefix of input matched by any regular expression along with its
+// token type. Both are empty if no regular expression matches a non empty prefix.
+func (t *Tokenizer) getMaxMatchingPrefix(input string) (string, string) {
+	dfa := t.automata
+	dfa.reset()
+	acceptedUpTo, acceptedTag := 0, -1
 	for pos, character := range input {
 		label := transitionLabel(string(character))
 		dfa.move(label)
@@ -39,53 +219,60 @@ func (t *Tokenizer) getMatchingPrefix(regexID string, input string) string {
 			break
 		}
 		if dfa.accepted {
-			acceptedAt = pos
+			acceptedUpTo, acceptedTag = pos+utf8.RuneLen(character), dfa.tags[dfa.current]
 		}
 	}
-	dfa.reset()
-	return input[:acceptedAt+1]
-}
 
-func (t *Tokenizer) getMaxMatchingPrefix(input string) (string, string) {
-	var maxPrefix string
-	var maxRegexID string
-	for id := range t.automata {
-		prefix := t.getMatchingPrefix(id, input)
-		if len(prefix) > len(maxPrefix) {
-			maxPrefix = prefix
-			maxRegexID = id
-		}
+	if acceptedTag < 0 {
+		return "", ""
 	}
-	return maxRegexID, maxPrefix
+	return t.tokenTypes[acceptedTag], input[:acceptedUpTo]
 }
 
-// Tokenize returns an array of tokens given an input string.
-func (t *Tokenizer) Tokenize(input string) []Token {
-	cleanedInput := ""
-	for _, character := range input {
-		if character != ' ' {
-			cleanedInput = strings.Join([]string{cleanedInput, string(character)}, "")
-		}
-	}
-
+// Tokenize returns an array of tokens given an input string. If some of the input is not matched by any regular
+// expression, the returned error is a *LexicalError for the first unmatched character. Unless error tokens are
+// turned on, the tokens returned alongside the error are the ones found before that character.
+func (t *Tokenizer) Tokenize(input string) ([]Token, error) {
+	var err error
 	tokens := make([]Token, 0, 100)
-	remainingInput := cleanedInput
+	remainingInput := input
+	position := Position{0, 1, 1}
 	for len(remainingInput) != 0 {
 		nextTokenType, nextLexeme := t.getMaxMatchingPrefix(remainingInput)
 		if len(nextLexeme) == 0 {
-			break
+			character, size := utf8.DecodeRuneInString(remainingInput)
+			if err == nil {
+				err = &LexicalError{position, character}
+			}
+			if !t.emitErrorTokens {
+				break
+			}
+
+			// Extend the previous error token if there is one right before this character.
+			end := position.advance(remainingInput[:size])
+			if last := len(tokens) - 1; last >= 0 && tokens[last].TokenType == ErrorTokenType && tokens[last].End == position {
+				tokens[last].Lexeme += remainingInput[:size]
+				tokens[last].End = end
+			} else {
+				tokens = append(tokens, Token{ErrorTokenType, remainingInput[:size], position, end})
+			}
+			remainingInput = remainingInput[size:]
+			position = end
+			continue
+		}
+		end := position.advance(nextLexeme)
+		if !t.skip[nextTokenType] {
+			tokens = append(tokens, Token{nextTokenType, nextLexeme, position, end})
 		}
-		tokens = append(tokens, Token{nextTokenType, nextLexeme})
 		remainingInput = remainingInput[len(nextLexeme):]
+		position = end
 	}
 
-	return tokens
+	return tokens, err
 }
 
 // Reset method of tokenizer resets the tokenizer back to its initial state so that it can parse new
 // strings.
 func (t *Tokenizer) Reset() {
-	for _, automata := range t.automata {
-		automata.reset()
-	}
+	t.automata.reset()
 }
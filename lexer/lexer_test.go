@@ -5,75 +5,78 @@ import (
 	"testing"
 )
 
-func TestTokenizerMatchingPrefix(t *testing.T) {
-	regexTable := map[string]RegularExpression{
-		"id":     "(a|b|c)(a|b|c|0|1|2)*",
-		"number": "(1|2)(0|1|2|3|4)*",
-		"+":      "+",
-		"*":      "/*",
-		"(":      "/(",
-		")":      "/)",
+func TestTokenizerMaxMatchingPrefix(t *testing.T) {
+	regexTable := TokenDefinitions{
+		{"id", "(a|b|c)(a|b|c|0|1|2)*"},
+		{"number", "(1|2)(0|1|2|3|4)*"},
+		{"=", "="},
+		{"==", "=="},
+		{"+", "+"},
+		{"*", "/*"},
+		{"(", "/("},
 	}
 	var tokenizer Tokenizer
 	tokenizer.Init(regexTable)
 
 	testData := []struct {
-		id       string
-		input    string
-		expected string
+		input          string
+		expectedID     string
+		expectedLexeme string
 	}{
-		{"id", "abc+12", "abc"},
-		{"number", "abc+12", ""},
-		{"id", "123+abc", ""},
-		{"number", "123+abc", "123"},
-		{"(", "(asdf", "("},
-		{"*", "*asdf", "*"},
-		{"*", "asdf", ""},
+		{"abc121", "id", "abc121"},
+		{"abc+", "id", "abc"},
+		{"==123", "==", "=="},
+		{"=123", "=", "="},
+		{"123+abc", "number", "123"},
+		{"(asdf", "(", "("},
+		{"*asdf", "*", "*"},
+		{"dabc", "", ""},
+		{"", "", ""},
 	}
 
 	for _, test := range testData {
-		if got := tokenizer.getMatchingPrefix(test.id, test.input); got != test.expected {
-			t.Errorf("Matching prefix expected %v, got %v", test.expected, got)
+		if gotID, gotLexeme := tokenizer.getMaxMatchingPrefix(test.input); gotID != test.expectedID || gotLexeme != test.expectedLexeme {
+			t.Errorf("Max matching prefix expected %v %v, got %v %v",
+				test.expectedID, test.expectedLexeme, gotID, gotLexeme)
 		}
 	}
 }
 
-func TestTokenizerMaxMatchingPrefix(t *testing.T) {
-	regexTable := map[string]RegularExpression{
-		"id": "(a|b|c)(a|b|c|0|1|2)*",
-		"=":  "=",
-		"==": "==",
-	}
-	var tokenizer Tokenizer
-	tokenizer.Init(regexTable)
-
-	testData := []struct {
+func TestTokenizerPriority(t *testing.T) {
+	var testData = []struct {
+		definitions    TokenDefinitions
 		input          string
 		expectedID     string
 		expectedLexeme string
 	}{
-		{"abc121", "id", "abc121"},
-		{"abc+", "id", "abc"},
-		{"==123", "==", "=="},
+		{TokenDefinitions{{"if", "if"}, {"id", "[a-z]+"}}, "if", "if", "if"},
+		{TokenDefinitions{{"id", "[a-z]+"}, {"if", "if"}}, "if", "id", "if"},
+		{TokenDefinitions{{"if", "if"}, {"id", "[a-z]+"}}, "iffy", "id", "iffy"},
+		{TokenDefinitions{{"if", "if"}, {"id", "[a-z]+"}}, "if(", "if", "if"},
 	}
 
 	for _, test := range testData {
-		if gotID, gotLexeme := tokenizer.getMaxMatchingPrefix(test.input); gotID != test.expectedID || gotLexeme != test.expectedLexeme {
-			t.Errorf("Max matching prefix expected %v %v, got %v %v",
-				test.expectedID, test.expectedLexeme, gotID, gotLexeme)
+		// Run a few times since a map based implementation would only fail some of the time.
+		for i := 0; i < 10; i++ {
+			var tokenizer Tokenizer
+			tokenizer.Init(test.definitions)
+			if gotID, gotLexeme := tokenizer.getMaxMatchingPrefix(test.input); gotID != test.expectedID || gotLexeme != test.expectedLexeme {
+				t.Errorf("Max matching prefix with definitions %v expected %v %v, got %v %v",
+					test.definitions, test.expectedID, test.expectedLexeme, gotID, gotLexeme)
+			}
 		}
 	}
 }
 
 func TestTokenizerTokenize(t *testing.T) {
-	regexTable := map[string]RegularExpression{
-		"id":     "(a|b|c)(a|b|c|0|1|2)*",
-		"+":      "+",
-		"=":      "=",
-		"==":     "==",
-		"number": "(1|2|3)(0|1|2|3)*",
-		"(":      "/(",
-		")":      "/)",
+	regexTable := TokenDefinitions{
+		{"id", "(a|b|c)(a|b|c|0|1|2)*"},
+		{"+", "+"},
+		{"=", "="},
+		{"==", "=="},
+		{"number", "(1|2|3)(0|1|2|3)*"},
+		{"(", "/("},
+		{")", "/)"},
 	}
 	var tokenizer Tokenizer
 	tokenizer.Init(regexTable)
@@ -85,17 +88,17 @@ func TestTokenizerTokenize(t *testing.T) {
 		{
 			"123+23",
 			[]Token{
-				{"number", "123"},
-				{"+", "+"},
-				{"number", "23"},
+				{"number", "123", Position{0, 1, 1}, Position{3, 1, 4}},
+				{"+", "+", Position{3, 1, 4}, Position{4, 1, 5}},
+				{"number", "23", Position{4, 1, 5}, Position{6, 1, 7}},
 			},
 		},
 		{
 			"abc==123",
 			[]Token{
-				{"id", "abc"},
-				{"==", "=="},
-				{"number", "123"},
+				{"id", "abc", Position{0, 1, 1}, Position{3, 1, 4}},
+				{"==", "==", Position{3, 1, 4}, Position{5, 1, 6}},
+				{"number", "123", Position{5, 1, 6}, Position{8, 1, 9}},
 			},
 		},
 		{
@@ -103,23 +106,287 @@ func TestTokenizerTokenize(t *testing.T) {
 			"**123",
 			[]Token{},
 		},
+		{
+			"12+*3",
+			[]Token{
+				{"number", "12", Position{0, 1, 1}, Position{2, 1, 3}},
+				{"+", "+", Position{2, 1, 3}, Position{3, 1, 4}},
+			},
+		},
 		{
 			"(12+123)+123",
 			[]Token{
-				{"(", "("},
-				{"number", "12"},
-				{"+", "+"},
-				{"number", "123"},
-				{")", ")"},
-				{"+", "+"},
-				{"number", "123"},
+				{"(", "(", Position{0, 1, 1}, Position{1, 1, 2}},
+				{"number", "12", Position{1, 1, 2}, Position{3, 1, 4}},
+				{"+", "+", Position{3, 1, 4}, Position{4, 1, 5}},
+				{"number", "123", Position{4, 1, 5}, Position{7, 1, 8}},
+				{")", ")", Position{7, 1, 8}, Position{8, 1, 9}},
+				{"+", "+", Position{8, 1, 9}, Position{9, 1, 10}},
+				{"number", "123", Position{9, 1, 10}, Position{12, 1, 13}},
 			},
 		},
 	}
 
 	for _, test := range testData {
-		if got := tokenizer.Tokenize(test.input); !reflect.DeepEqual(got, test.expected) {
+		if got, _ := tokenizer.Tokenize(test.input); !reflect.DeepEqual(got, test.expected) {
 			t.Errorf("Tokenization on input %v expected %v, got %v", test.input, test.expected, got)
 		}
 	}
 }
+
+func TestTokenizerLexicalError(t *testing.T) {
+	regexTable := TokenDefinitions{
+		{"id", "[a-z]+"},
+		{"+", "/+"},
+		{"whitespace", "[ \n]+"},
+	}
+	var tokenizer Tokenizer
+	tokenizer.Init(regexTable)
+	tokenizer.Skip([]string{"whitespace"})
+
+	testData := []struct {
+		emitErrorTokens bool
+		input           string
+		expected        []Token
+		expectedError   error
+	}{
+		{
+			false,
+			"ab + cd",
+			[]Token{
+				{"id", "ab", Position{0, 1, 1}, Position{2, 1, 3}},
+				{"+", "+", Position{3, 1, 4}, Position{4, 1, 5}},
+				{"id", "cd", Position{5, 1, 6}, Position{7, 1, 8}},
+			},
+			nil,
+		},
+		{
+			false,
+			"ab +\n 12 + cd",
+			[]Token{
+				{"id", "ab", Position{0, 1, 1}, Position{2, 1, 3}},
+				{"+", "+", Position{3, 1, 4}, Position{4, 1, 5}},
+			},
+			&LexicalError{Position{6, 2, 2}, '1'},
+		},
+		{
+			true,
+			"ab +\n 12 + c$",
+			[]Token{
+				{"id", "ab", Position{0, 1, 1}, Position{2, 1, 3}},
+				{"+", "+", Position{3, 1, 4}, Position{4, 1, 5}},
+				{ErrorTokenType, "12", Position{6, 2, 2}, Position{8, 2, 4}},
+				{"+", "+", Position{9, 2, 5}, Position{10, 2, 6}},
+				{"id", "c", Position{11, 2, 7}, Position{12, 2, 8}},
+				{ErrorTokenType, "$", Position{12, 2, 8}, Position{13, 2, 9}},
+			},
+			&LexicalError{Position{6, 2, 2}, '1'},
+		},
+	}
+
+	for _, test := range testData {
+		tokenizer.EmitErrorTokens(test.emitErrorTokens)
+		got, err := tokenizer.Tokenize(test.input)
+		if !reflect.DeepEqual(got, test.expected) {
+			t.Errorf("Tokenization on input %q expected %v, got %v", test.input, test.expected, got)
+		}
+		if !reflect.DeepEqual(err, test.expectedError) {
+			t.Errorf("Tokenization on input %q expected error %v, got %v", test.input, test.expectedError, err)
+		}
+	}
+}
+
+func TestLexicalErrorMessage(t *testing.T) {
+	err := &LexicalError{Position{6, 2, 2}, '$'}
+	if got, expected := err.Error(), "2:2: unexpected character '$'"; got != expected {
+		t.Errorf("Expected error message %q, got %q", expected, got)
+	}
+}
+
+func TestTokenizerTokenPositions(t *testing.T) {
+	regexTable := TokenDefinitions{
+		{"id", "[a-zé]+"},
+		{"+", "/+"},
+		{"whitespace", "[ \t\n]+"},
+	}
+	var tokenizer Tokenizer
+	tokenizer.Init(regexTable)
+	tokenizer.Skip([]string{"whitespace"})
+
+	expected := []Token{
+		{"id", "ab", Position{2, 1, 3}, Position{4, 1, 5}},
+		{"+", "+", Position{5, 1, 6}, Position{6, 1, 7}},
+		{"id", "é", Position{8, 2, 2}, Position{10, 2, 3}},
+		{"+", "+", Position{10, 2, 3}, Position{11, 2, 4}},
+		{"id", "cd", Position{12, 2, 5}, Position{14, 2, 7}},
+	}
+	if got, err := tokenizer.Tokenize("  ab +\n é+\tcd"); err != nil || !reflect.DeepEqual(got, expected) {
+		t.Errorf("Expected tokens %v, got %v", expected, got)
+	}
+}
+
+func TestTokenizerSkip(t *testing.T) {
+	regexTable := TokenDefinitions{
+		{"id", "[a-z]+"},
+		{"string", "\"[^\"]*\""},
+		{"whitespace", "[ \t\n]+"},
+	}
+	var tokenizer Tokenizer
+	tokenizer.Init(regexTable)
+
+	testData := []struct {
+		skip     []string
+		input    string
+		expected []Token
+	}{
+		{
+			[]string{"whitespace"},
+			"a b",
+			[]Token{
+				{"id", "a", Position{0, 1, 1}, Position{1, 1, 2}},
+				{"id", "b", Position{2, 1, 3}, Position{3, 1, 4}},
+			},
+		},
+		{
+			[]string{"whitespace"},
+			"ab \"c d\"",
+			[]Token{
+				{"id", "ab", Position{0, 1, 1}, Position{2, 1, 3}},
+				{"string", "\"c d\"", Position{3, 1, 4}, Position{8, 1, 9}},
+			},
+		},
+		{
+			nil,
+			"a\tb",
+			[]Token{
+				{"id", "a", Position{0, 1, 1}, Position{1, 1, 2}},
+				{"whitespace", "\t", Position{1, 1, 2}, Position{2, 1, 3}},
+				{"id", "b", Position{2, 1, 3}, Position{3, 1, 4}},
+			},
+		},
+	}
+
+	for _, test := range testData {
+		tokenizer.Skip(test.skip)
+		if got, err := tokenizer.Tokenize(test.input); err != nil || !reflect.DeepEqual(got, test.expected) {
+			t.Errorf("Tokenization on input %q expected %v, got %v", test.input, test.expected, got)
+		}
+	}
+}
+
+func TestPositionAdvance(t *testing.T) {
+	var testData = []struct {
+		start    Position
+		text     string
+		expected Position
+	}{
+		{Position{0, 1, 1}, "abc", Position{3, 1, 4}},
+		{Position{3, 1, 4}, "a\nb", Position{6, 2, 2}},
+		{Position{0, 1, 1}, "é", Position{2, 1, 2}},
+		{Position{5, 2, 3}, "", Position{5, 2, 3}},
+	}
+
+	for _, test := range testData {
+		if got := test.start.advance(test.text); got != test.expected {
+			t.Errorf("Expected %v.advance(%q) = %v, got %v", test.start, test.text, test.expected, got)
+		}
+	}
+}
+
+func TestTokenizerStatistics(t *testing.T) {
+	regexTable := TokenDefinitions{
+		{"id", "(a|b|c)(a|b|c)*"},
+		{"number", "(1|2)(1|2)*"},
+	}
+	var tokenizer Tokenizer
+	tokenizer.Init(regexTable)
+
+	expected := Statistics{NfaStates: 37, DfaStates: 11, MinimizedDfaStates: 3}
+	if got := tokenizer.Statistics(); got != expected {
+		t.Errorf("Expected statistics %+v, got %+v", expected, got)
+	}
+}
+
+func TestTokenizerTables(t *testing.T) {
+	var tokenizer Tokenizer
+	tokenizer.Init(TokenDefinitions{{"if", "if"}, {"id", "[a-z][a-z0-9]*"}, {"number", "[0-9]+"}})
+	tables := tokenizer.Tables()
+
+	// Run the tables the way generated code does, and check that they match like the tokenizer.
+	matchTables := func(input string) (string, string) {
+		s, length, tag := 0, 0, -1
+		for pos, character := range input {
+			next := -1
+			for _, transition := range tables.Transitions[s] {
+				if transition.Low <= character && character <= transition.High {
+					next = transition.Next
+				}
+			}
+			if next < 0 {
+				break
+			}
+			s = next
+			if tables.Accepts[s] >= 0 {
+				length, tag = pos+1, tables.Accepts[s]
+			}
+		}
+		if tag < 0 {
+			return "", ""
+		}
+		return tables.TokenTypes[tag], input[:length]
+	}
+
+	for _, input := range []string{"if", "ifx", "i", "x9 y", "42+", "+"} {
+		expectedType, expectedLexeme := tokenizer.getMaxMatchingPrefix(input)
+		if gotType, gotLexeme := matchTables(input); gotType != expectedType || gotLexeme != expectedLexeme {
+			t.Errorf("Expected tables to match %v %q on %q, got %v %q", expectedType, expectedLexeme, input, gotType, gotLexeme)
+		}
+	}
+	for s, transitions := range tables.Transitions {
+		for i := 1; i < len(transitions); i++ {
+			if transitions[i].Low <= transitions[i-1].High {
+				t.Errorf("Expected transitions of state %v to be sorted and disjoint, got %v", s, transitions)
+			}
+		}
+	}
+}
+
+func TestTokenizerInitFromTables(t *testing.T) {
+	var built Tokenizer
+	built.Init(TokenDefinitions{{"if", "if"}, {"id", "[a-z][a-z0-9]*"}, {"number", "[0-9]+"}, {"space", " +"}})
+	built.Skip([]string{"space"})
+
+	var loaded Tokenizer
+	if err := loaded.InitFromTables(built.Tables()); err != nil {
+		t.Fatalf("Expected tables to be loaded, got %v", err)
+	}
+	loaded.Skip([]string{"space"})
+
+	if !reflect.DeepEqual(loaded.Tables(), built.Tables()) {
+		t.Errorf("Expected the loaded tokenizer to have the tables %v, got %v", built.Tables(), loaded.Tables())
+	}
+	for _, input := range []string{"if x1 42 ifs", "if +"} {
+		expectedTokens, expectedErr := built.Tokenize(input)
+		tokens, err := loaded.Tokenize(input)
+		if !reflect.DeepEqual(tokens, expectedTokens) || !reflect.DeepEqual(err, expectedErr) {
+			t.Errorf("Expected %v and %v on %q, got %v and %v", expectedTokens, expectedErr, input, tokens, err)
+		}
+	}
+
+	var testData = []struct {
+		change        func(tables *Tables)
+		expectedError string
+	}{
+		{func(tables *Tables) { tables.Accepts = tables.Accepts[1:] }, "tables have 5 accepting token types for 6 states"},
+		{func(tables *Tables) { tables.Transitions[0][0].Next = 6 }, "transition of state 0 goes to state 6, which is out of range"},
+		{func(tables *Tables) { tables.Transitions[0][0] = Transition{'b', 'a', 1} }, "transition of state 0 has the empty range 'b'-'a'"},
+		{func(tables *Tables) { tables.Accepts[1] = 4 }, "state 1 accepts token type 4, which is out of range"},
+	}
+	for _, test := range testData {
+		tables := built.Tables()
+		test.change(&tables)
+		if err := loaded.InitFromTables(tables); err == nil || err.Error() != test.expectedError {
+			t.Errorf("Expected the error %q, got %v", test.expectedError, err)
+		}
+	}
+}
@@ -0,0 +1,206 @@
+package lexer
+
+import "sort"
+
+// getStates returns every state of the DFA, in increasing order.
+func (d *deterministicFiniteAutomata) getStates() []state {
+	seen := setOfStates{d.start: true}
+	for s, row := range d.transitionGraph {
+		seen.add(s)
+		for _, e := range row {
+			seen.add(e)
+		}
+	}
+	for s := range d.final {
+		seen.add(s)
+	}
+
+	states := make([]state, 0, len(seen))
+	for s := range seen {
+		states = append(states, s)
+	}
+	sort.Slice(states, func(i, j int) bool { return states[i] < states[j] })
+	return states
+}
+
+// minimize returns the smallest DFA recognising the same language using Hopcroft's partition refinement. Final
+// states are only merged with final states having the same tag, so the token type of every match is kept.
+func (d *deterministicFiniteAutomata) minimize() deterministicFiniteAutomata {
+	states := d.getStates()
+	index := make(map[state]int, len(states))
+	for i, s := range states {
+		index[s] = i
+	}
+
+	// Labels on different states may overlap, so transitions are compared on a common alphabet of disjoint
+	// labels. A dead state stands in for missing transitions to make the DFA complete.
+	allLabels := make(setOfTransitionLables)
+	for _, row := range d.transitionGraph {
+		for l := range row {
+			allLabels.add(l)
+		}
+	}
+	alphabet := partitionLabels(allLabels).sorted()
+	dead := len(states)
+	inverse := make([][][]int, len(alphabet))
+	for a := range alphabet {
+		inverse[a] = make([][]int, dead+1)
+		inverse[a][dead] = append(inverse[a][dead], dead)
+	}
+	for i, s := range states {
+		for a, atom := range alphabet {
+			target := dead
+			for l, e := range d.transitionGraph[s] {
+				if l.covers(atom) {
+					target = index[e]
+					break
+				}
+			}
+			inverse[a][target] = append(inverse[a][target], i)
+		}
+	}
+
+	// The initial partition separates non final states from final states of each tag.
+	blockOf := make([]int, dead+1)
+	blocks := make([][]int, 0, 10)
+	blockOfTag := make(map[int]int)
+	for i := 0; i <= dead; i++ {
+		tag := -1
+		if i != dead && d.final.has(states[i]) {
+			tag = 0
+			if d.tags != nil {
+				tag = d.tags[states[i]] + 1
+			}
+		}
+		b, ok := blockOfTag[tag]
+		if !ok {
+			b = len(blocks)
+			blockOfTag[tag] = b
+			blocks = append(blocks, nil)
+		}
+		blocks[b] = append(blocks[b], i)
+		blockOf[i] = b
+	}
+
+	worklist := make([]int, 0, len(blocks))
+	inWorklist := make([]bool, len(blocks))
+	for b := range blocks {
+		worklist = append(worklist, b)
+		inWorklist[b] = true
+	}
+	for len(worklist) > 0 {
+		splitter := append([]int(nil), blocks[worklist[0]]...)
+		inWorklist[worklist[0]] = false
+		worklist = worklist[1:]
+
+		for a := range alphabet {
+			// Group the states moving into the splitter on this label by the block they belong to.
+			movingIn := make(map[int][]int)
+			for _, t := range splitter {
+				for _, s := range inverse[a][t] {
+					movingIn[blockOf[s]] = append(movingIn[blockOf[s]], s)
+				}
+			}
+
+			for b, inside := range movingIn {
+				if len(inside) == len(blocks[b]) {
+					continue
+				}
+				isInside := make(map[int]bool, len(inside))
+				for _, s := range inside {
+					isInside[s] = true
+				}
+				outside := make([]int, 0, len(blocks[b])-len(inside))
+				for _, s := range blocks[b] {
+					if !isInside[s] {
+						outside = append(outside, s)
+					}
+				}
+
+				newBlock := len(blocks)
+				blocks[b] = outside
+				blocks = append(blocks, inside)
+				inWorklist = append(inWorklist, false)
+				for _, s := range inside {
+					blockOf[s] = newBlock
+				}
+				switch {
+				case inWorklist[b]:
+					worklist = append(worklist, newBlock)
+					inWorklist[newBlock] = true
+				case len(inside) < len(outside):
+					worklist = append(worklist, newBlock)
+					inWorklist[newBlock] = true
+				default:
+					worklist = append(worklist, b)
+					inWorklist[b] = true
+				}
+			}
+		}
+	}
+
+	return d.buildFromPartition(states, blockOf, blockOf[dead])
+}
+
+// buildFromPartition builds a DFA with one state per block of equivalent states, leaving out the block of
+// states equivalent to the dead state. States are numbered in breadth first order from the start state.
+func (d *deterministicFiniteAutomata) buildFromPartition(states []state, blockOf []int, deadBlock int) deterministicFiniteAutomata {
+	index := make(map[state]int, len(states))
+	representative := make(map[int]state)
+	for i, s := range states {
+		index[s] = i
+		if _, ok := representative[blockOf[i]]; !ok {
+			representative[blockOf[i]] = s
+		}
+	}
+
+	minimized := deterministicFiniteAutomata{start: 0, final: make(setOfStates), transitionGraph: make(deterministicGraph)}
+	if d.tags != nil {
+		minimized.tags = make(map[state]int)
+	}
+	newState := map[int]state{blockOf[index[d.start]]: 0}
+	q := []int{blockOf[index[d.start]]}
+	for len(q) > 0 {
+		block := q[0]
+		q = q[1:]
+		s := representative[block]
+		if d.final.has(s) {
+			minimized.final.add(newState[block])
+			if d.tags != nil {
+				minimized.tags[newState[block]] = d.tags[s]
+			}
+		}
+
+		// Labels going to the same block are merged into a single label.
+		labelsOfTarget := make(map[int]characterClass)
+		targets := make([]int, 0, len(d.transitionGraph[s]))
+		for _, l := range d.getOutgoingLabels(s) {
+			target := blockOf[index[d.transitionGraph[s][l]]]
+			if target == deadBlock {
+				continue
+			}
+			if _, ok := labelsOfTarget[target]; !ok {
+				targets = append(targets, target)
+			}
+			labelsOfTarget[target] = append(labelsOfTarget[target], l.class()...)
+		}
+		for _, target := range targets {
+			if _, ok := newState[target]; !ok {
+				newState[target] = state(len(newState))
+				q = append(q, target)
+			}
+			minimized.transitionGraph.addTransition(newState[block], newState[target], labelsOfTarget[target].normalize().label())
+		}
+	}
+
+	minimized.current = minimized.start
+	return minimized
+}
+
+func (d *deterministicFiniteAutomata) getOutgoingLabels(s state) []transitionLabel {
+	labels := make(setOfTransitionLables)
+	for l := range d.transitionGraph[s] {
+		labels.add(l)
+	}
+	return labels.sorted()
+}
@@ -0,0 +1,109 @@
+package lexer
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDeterministicFiniteAutomataGetStates(t *testing.T) {
+	var nfa1, nfa2 nondeterministicFiniteAutomata
+	nfa1.init("a")
+	nfa2.init("b")
+	nfa1.combineUsingUnion(&nfa2)
+	nfa1.applyStar()
+	dfa := nfa1.convertToDfa()
+
+	if got, expected := dfa.getStates(), []state{0, 1, 2}; !reflect.DeepEqual(got, expected) {
+		t.Errorf("Expected states to be %v, got %v", expected, got)
+	}
+}
+
+func TestDeterministicFiniteAutomataMinimize(t *testing.T) {
+	var testData = []struct {
+		inputRegex     RegularExpression
+		expectedStates int
+	}{
+		{"(a|b)*", 1},
+		{"a(b|c)*", 2},
+		{"(ab)|(ac)", 3},
+		{"[a-z]|[a-m]x", 3},
+		{"(a|b)*abb", 4},
+		{"x{2,4}", 5},
+	}
+
+	for _, test := range testData {
+		nfa := test.inputRegex.compile()
+		dfa := nfa.convertToDfa()
+		minimized := dfa.minimize()
+		if got := len(minimized.getStates()); got != test.expectedStates {
+			t.Errorf("Expected %v to minimize to %v states, got %v", test.inputRegex, test.expectedStates, got)
+		}
+	}
+}
+
+func TestDeterministicFiniteAutomataMinimizeKeepsLanguage(t *testing.T) {
+	var testData = []struct {
+		inputRegex RegularExpression
+		testInput  string
+	}{
+		{"(a|b)*abb", "abb"},
+		{"(a|b)*abb", "babaabb"},
+		{"(a|b)*abb", "abba"},
+		{"[a-z]|[a-m]x", "q"},
+		{"[a-z]|[a-m]x", "cx"},
+		{"[a-z]|[a-m]x", "qx"},
+		{"x{2,4}", "x"},
+		{"x{2,4}", "xxx"},
+		{"x{2,4}", "xxxxx"},
+	}
+
+	for _, test := range testData {
+		nfa := test.inputRegex.compile()
+		dfa := nfa.convertToDfa()
+		minimized := dfa.minimize()
+		for _, character := range test.testInput {
+			dfa.move(transitionLabel(character))
+			minimized.move(transitionLabel(character))
+		}
+		if dfa.accepted != minimized.accepted {
+			t.Errorf("Expected minimized %v to accept %v like the original, got %v",
+				test.inputRegex, test.testInput, minimized.accepted)
+		}
+	}
+}
+
+func TestDeterministicFiniteAutomataMinimizeKeepsTags(t *testing.T) {
+	regexes := []RegularExpression{"if", "[a-z]+", "[0-9]+"}
+	nfas := make([]nondeterministicFiniteAutomata, 0, len(regexes))
+	for _, regex := range regexes {
+		nfas = append(nfas, regex.compile())
+	}
+	nfa := combineUsingTaggedUnion(nfas)
+	dfa := nfa.convertToDfa()
+	minimized := dfa.minimize()
+
+	var testData = []struct {
+		input       string
+		expectedTag int
+	}{
+		{"if", 0},
+		{"i", 1},
+		{"iff", 1},
+		{"42", 2},
+		{"4x", -1},
+	}
+
+	for _, test := range testData {
+		minimized.reset()
+		for _, character := range test.input {
+			minimized.move(transitionLabel(character))
+		}
+		got := -1
+		if minimized.accepted {
+			got = minimized.tags[minimized.current]
+		}
+		if got != test.expectedTag {
+			t.Errorf("Expected tag of %q to be %v, got %v", test.input, test.expectedTag, got)
+		}
+	}
+}
@@ -1,54 +1,102 @@
 package lexer
 
+import (
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
 type regularExpressionOperator int
 
 const (
 	union regularExpressionOperator = iota
 	concat
 	star
+	plus
+	optional
+	repeat
 )
 
+// length is the number of characters taken up by the operator. The length of repeat depends on its bounds, so
+// it is computed by RegularExpression.getOperatorLength instead.
 func (r regularExpressionOperator) length() int {
 	switch r {
-	case union:
-		return 1
-	case star:
+	case union, star, plus, optional:
 		return 1
 	default:
 		return 0
 	}
 }
 
+func (r regularExpressionOperator) isPostfix() bool {
+	return r == star || r == plus || r == optional || r == repeat
+}
+
 // RegularExpression represents the string representation of regular expressions. It has methods for
 // regular expression operations and compilation.
 type RegularExpression string
 
+// getCharacters splits the regular expression into its smallest units. A unit is either a character, an escaped
+// character like "/*" or a whole bracket expression like "[a-z]".
 func (r RegularExpression) getCharacters() []string {
 	characters := make([]string, 0, 100)
 	for i := 0; i < len(r); {
-		if r[i] == '/' {
-			characters = append(characters, string(r[i])+string(r[i+1]))
-			i += 2
-		} else {
-			characters = append(characters, string(r[i]))
-			i++
+		switch {
+		case r[i] == '/' && i+1 < len(r):
+			_, size := utf8.DecodeRuneInString(string(r[i+1:]))
+			characters = append(characters, string(r[i:i+1+size]))
+			i += 1 + size
+		case r[i] == '[':
+			end := r.getClassEndIndex(i)
+			characters = append(characters, string(r[i:end+1]))
+			i = end + 1
+		default:
+			_, size := utf8.DecodeRuneInString(string(r[i:]))
+			characters = append(characters, string(r[i:i+size]))
+			i += size
 		}
 	}
 	return characters
 }
 
+// getClassEndIndex returns the index of the "]" closing the bracket expression starting at start, or the index
+// of the last byte if the bracket expression is never closed.
+func (r RegularExpression) getClassEndIndex(start int) int {
+	for i := start + 1; i < len(r); i++ {
+		switch r[i] {
+		case '/':
+			i++
+		case ']':
+			return i
+		}
+	}
+	return len(r) - 1
+}
+
 func (r RegularExpression) isValid() bool {
 	s := make(stack, 0, 10)
+	offset := 0
 	for _, currentCharacter := range r.getCharacters() {
-		switch currentCharacter {
-		case "(":
+		switch {
+		case currentCharacter == "(":
 			s.push('(')
-		case ")":
+		case currentCharacter == ")":
 			if s.empty() {
 				return false
 			}
 			s.pop()
+		case currentCharacter == "/":
+			return false
+		case currentCharacter == "{":
+			if min, max, _, ok := parseRepetitionBounds(string(r[offset:])); ok && max >= 0 && min > max {
+				return false
+			}
+		case currentCharacter[0] == '[':
+			if _, ok := parseCharacterClass(currentCharacter); !ok {
+				return false
+			}
 		}
+		offset += len(currentCharacter)
 	}
 
 	return s.empty()
@@ -78,11 +126,7 @@ func (r RegularExpression) getMatchingParenIndex() int {
 }
 
 func (r RegularExpression) trimParenthesis() RegularExpression {
-	characters := r.getCharacters()
-	if characters[0] != "(" {
-		return r
-	}
-	if characters[len(characters)-1] != ")" {
+	if r.getMatchingParenIndex() != len(r)-1 {
 		return r
 	}
 	return r[1 : len(r)-1]
@@ -99,18 +143,46 @@ func (r RegularExpression) getFirstOperand() RegularExpression {
 
 func (r RegularExpression) getOperator() regularExpressionOperator {
 	operatorIndex := len(r.getFirstOperand())
+	if operatorIndex == len(r) {
+		return concat
+	}
 	switch r[operatorIndex] {
 	case '|':
 		return union
 	case '*':
 		return star
+	case '+':
+		return plus
+	case '?':
+		return optional
+	case '{':
+		// A "{" that does not start valid bounds is an ordinary character.
+		if _, _, _, ok := parseRepetitionBounds(string(r[operatorIndex:])); ok {
+			return repeat
+		}
+		return concat
 	default:
 		return concat
 	}
 }
 
+func (r RegularExpression) getOperatorLength() int {
+	operator := r.getOperator()
+	if operator != repeat {
+		return operator.length()
+	}
+	_, _, length, _ := parseRepetitionBounds(string(r[len(r.getFirstOperand()):]))
+	return length
+}
+
+// getRepetitionBounds assumes that the operator is repeat. An unbounded maximum is returned as -1.
+func (r RegularExpression) getRepetitionBounds() (int, int) {
+	min, max, _, _ := parseRepetitionBounds(string(r[len(r.getFirstOperand()):]))
+	return min, max
+}
+
 func (r RegularExpression) getSecondOperand() RegularExpression {
-	secondOperandIndex := len(r.getFirstOperand()) + r.getOperator().length()
+	secondOperandIndex := len(r.getFirstOperand()) + r.getOperatorLength()
 	return RegularExpression(r[secondOperandIndex:])
 }
 
@@ -124,33 +196,117 @@ func (r RegularExpression) compile() nondeterministicFiniteAutomata {
 
 	if len(characters) == 1 {
 		var f nondeterministicFiniteAutomata
-		character := characters[0]
-		switch len(character) {
-		case 2:
-			f.init(transitionLabel(character[1]))
-		case 1:
-			f.init(transitionLabel(character[0]))
-		}
+		f.init(getCharacterLabel(characters[0]))
 		return f
 	}
 
 	firstOperand := r.getFirstOperand()
-	switch r.getOperator() {
+	if len(firstOperand) == len(r) {
+		return firstOperand.trimParenthesis().compile()
+	}
+
+	var firstOperandAutomata nondeterministicFiniteAutomata
+	operator := r.getOperator()
+	switch operator {
 	case star:
-		firstOperandAutomata := firstOperand.trimParenthesis().compile()
+		firstOperandAutomata = firstOperand.trimParenthesis().compile()
 		firstOperandAutomata.applyStar()
-		return firstOperandAutomata
-	case union:
-		firstOperandAutomata := firstOperand.trimParenthesis().compile()
-		secondOperand := r.getSecondOperand()
-		secondOperandAutomata := secondOperand.trimParenthesis().compile()
-		firstOperandAutomata.combineUsingUnion(&secondOperandAutomata)
-		return firstOperandAutomata
+	case plus:
+		firstOperandAutomata = firstOperand.trimParenthesis().compile()
+		firstOperandAutomata.applyPlus()
+	case optional:
+		firstOperandAutomata = firstOperand.trimParenthesis().compile()
+		firstOperandAutomata.applyOptional()
+	case repeat:
+		firstOperandAutomata = firstOperand.trimParenthesis().compileRepetition(r.getRepetitionBounds())
 	default:
-		firstOperandAutomata := firstOperand.trimParenthesis().compile()
-		secondOperand := r.getSecondOperand()
-		secondOperandAutomata := secondOperand.trimParenthesis().compile()
+		firstOperandAutomata = firstOperand.trimParenthesis().compile()
+	}
+
+	secondOperand := r.getSecondOperand()
+	if operator.isPostfix() {
+		// Postfix operators apply to the first operand only. Whatever follows them is either a union or a
+		// concatenation with the result.
+		if len(secondOperand) == 0 {
+			return firstOperandAutomata
+		}
+		if secondOperand[0] == '|' {
+			operator, secondOperand = union, secondOperand[1:]
+		} else {
+			operator = concat
+		}
+	}
+
+	secondOperandAutomata := secondOperand.trimParenthesis().compile()
+	if operator == union {
+		firstOperandAutomata.combineUsingUnion(&secondOperandAutomata)
+	} else {
 		firstOperandAutomata.combineUsingConcat(&secondOperandAutomata)
-		return firstOperandAutomata
 	}
+	return firstOperandAutomata
+}
+
+// compileRepetition builds an automata matching between min and max repetitions of r. A negative max means
+// there is no upper bound.
+func (r RegularExpression) compileRepetition(min int, max int) nondeterministicFiniteAutomata {
+	var f nondeterministicFiniteAutomata
+	f.init("")
+	for i := 0; i < min; i++ {
+		next := r.compile()
+		f.combineUsingConcat(&next)
+	}
+
+	if max < 0 {
+		next := r.compile()
+		next.applyStar()
+		f.combineUsingConcat(&next)
+		return f
+	}
+
+	for i := min; i < max; i++ {
+		next := r.compile()
+		next.applyOptional()
+		f.combineUsingConcat(&next)
+	}
+	return f
+}
+
+func getCharacterLabel(character string) transitionLabel {
+	switch {
+	case character[0] == '/' && len(character) > 1:
+		return transitionLabel(character[1:])
+	case character == ".":
+		return anyCharacter.label()
+	case character[0] == '[':
+		class, _ := parseCharacterClass(character)
+		return class.label()
+	default:
+		return transitionLabel(character)
+	}
+}
+
+// parseRepetitionBounds parses bounds of the form {m}, {m,} or {m,n} at the start of s. It returns the minimum,
+// the maximum (-1 if unbounded), the length of the bounds and whether s starts with bounds at all.
+func parseRepetitionBounds(s string) (int, int, int, bool) {
+	end := strings.IndexByte(s, '}')
+	if len(s) == 0 || s[0] != '{' || end < 0 {
+		return 0, 0, 0, false
+	}
+
+	bounds := strings.SplitN(s[1:end], ",", 2)
+	min, err := strconv.Atoi(bounds[0])
+	if err != nil || min < 0 {
+		return 0, 0, 0, false
+	}
+	if len(bounds) == 1 {
+		return min, min, end + 1, true
+	}
+	if bounds[1] == "" {
+		return min, -1, end + 1, true
+	}
+	max, err := strconv.Atoi(bounds[1])
+	if err != nil || max < 0 {
+		return 0, 0, 0, false
+	}
+	return min, max, end + 1, true
 }
@@ -1,6 +1,9 @@
 package lexer
 
-import "testing"
+import (
+	"reflect"
+	"testing"
+)
 
 func TestRegularExpressionOperatorLength(t *testing.T) {
 	var testData = []struct {
@@ -10,6 +13,8 @@ func TestRegularExpressionOperatorLength(t *testing.T) {
 		{union, 1},
 		{concat, 0},
 		{star, 1},
+		{plus, 1},
+		{optional, 1},
 	}
 
 	for _, test := range testData {
@@ -19,6 +24,25 @@ func TestRegularExpressionOperatorLength(t *testing.T) {
 	}
 }
 
+func TestRegularExpressionGetCharacters(t *testing.T) {
+	var testData = []struct {
+		input    RegularExpression
+		expected []string
+	}{
+		{"ab/*", []string{"a", "b", "/*"}},
+		{"[a-z]x*", []string{"[a-z]", "x", "*"}},
+		{"[^/]a]b", []string{"[^/]a]", "b"}},
+		{"(.|é)", []string{"(", ".", "|", "é", ")"}},
+		{"[a-", []string{"[a-"}},
+	}
+
+	for _, test := range testData {
+		if got := test.input.getCharacters(); !reflect.DeepEqual(got, test.expected) {
+			t.Errorf("Expected %v.getCharacters() = %v, got %v", test.input, test.expected, got)
+		}
+	}
+}
+
 func TestRegularExpressionIsValid(t *testing.T) {
 	var testData = []struct {
 		input    RegularExpression
@@ -33,6 +57,14 @@ func TestRegularExpressionIsValid(t *testing.T) {
 		{"/(", true},
 		{"/)", true},
 		{"/(/((a)b(c)/)", true},
+		{"[a-z][a-z0-9]*", true},
+		{"[^/]]", true},
+		{"[a-z", false},
+		{"[z-a]", false},
+		{"ab/", false},
+		{"a{2,3}", true},
+		{"a{3,2}", false},
+		{"a{", true},
 	}
 
 	for _, test := range testData {
@@ -70,6 +102,7 @@ func TestRegularExpressionTrimParenthesis(t *testing.T) {
 		{"sdfasf", "sdfasf"},
 		{"(sdfsdf)*", "(sdfsdf)*"},
 		{"/(sdfasf/)", "/(sdfasf/)"},
+		{"(a)(b)", "(a)(b)"},
 	}
 
 	for _, test := range testData {
@@ -92,6 +125,11 @@ func TestRegularExpressionGetOperandsAndOperator(t *testing.T) {
 		{"(sdfsdf)*", "(sdfsdf)", star, ""},
 		{"/(sdfsdf/)", "/(", concat, "sdfsdf/)"},
 		{"(sdf/|/*abc)|(cdf)", "(sdf/|/*abc)", union, "(cdf)"},
+		{"a+b", "a", plus, "b"},
+		{"(ab)?|c", "(ab)", optional, "|c"},
+		{"[0-9]{2,4}x", "[0-9]", repeat, "x"},
+		{"a{,2}", "a", concat, "{,2}"},
+		{"a/+", "a", concat, "/+"},
 	}
 
 	for _, test := range testData {
@@ -110,3 +148,29 @@ func TestRegularExpressionGetOperandsAndOperator(t *testing.T) {
 		}
 	}
 }
+
+func TestParseRepetitionBounds(t *testing.T) {
+	var testData = []struct {
+		input          string
+		expectedMin    int
+		expectedMax    int
+		expectedLength int
+		expectedOk     bool
+	}{
+		{"{3}", 3, 3, 3, true},
+		{"{2,}abc", 2, -1, 4, true},
+		{"{2,5}", 2, 5, 5, true},
+		{"{,5}", 0, 0, 0, false},
+		{"{a}", 0, 0, 0, false},
+		{"{2", 0, 0, 0, false},
+		{"2}", 0, 0, 0, false},
+	}
+
+	for _, test := range testData {
+		min, max, length, ok := parseRepetitionBounds(test.input)
+		if min != test.expectedMin || max != test.expectedMax || length != test.expectedLength || ok != test.expectedOk {
+			t.Errorf("Expected parseRepetitionBounds(%q) = %v, %v, %v, %v, got %v, %v, %v, %v", test.input,
+				test.expectedMin, test.expectedMax, test.expectedLength, test.expectedOk, min, max, length, ok)
+		}
+	}
+}
@@ -0,0 +1,85 @@
+package lexer
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+)
+
+// TokenDefinition pairs a token type with the regular expression that matches it.
+type TokenDefinition struct {
+	TokenType string
+	Regex     RegularExpression
+}
+
+// TokenDefinitions is an ordered list of token definitions. When several regular expressions match the same
+// longest prefix, the token type defined first wins, so keywords should be defined before identifiers.
+//
+// In JSON, token definitions are written as an object mapping token types to regular expressions. The order of
+// the keys in the object is kept.
+type TokenDefinitions []TokenDefinition
+
+// Set changes the regular expression of an existing token type in place, or adds a new token type at the end.
+func (d *TokenDefinitions) Set(tokenType string, regex RegularExpression) {
+	for i := range *d {
+		if (*d)[i].TokenType == tokenType {
+			(*d)[i].Regex = regex
+			return
+		}
+	}
+	*d = append(*d, TokenDefinition{tokenType, regex})
+}
+
+// UnmarshalJSON reads a JSON object, keeping the order in which its keys are written.
+func (d *TokenDefinitions) UnmarshalJSON(data []byte) error {
+	*d = nil
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	start, err := decoder.Token()
+	if err != nil {
+		return err
+	}
+	if start == nil {
+		return nil
+	}
+	if delim, ok := start.(json.Delim); !ok || delim != '{' {
+		return fmt.Errorf("token definitions must be a JSON object, got %v", start)
+	}
+
+	for decoder.More() {
+		key, err := decoder.Token()
+		if err != nil {
+			return err
+		}
+		var regex RegularExpression
+		if err := decoder.Decode(&regex); err != nil {
+			return err
+		}
+		d.Set(key.(string), regex)
+	}
+	_, err = decoder.Token()
+	return err
+}
+
+// MarshalJSON writes token definitions as a JSON object with keys in definition order.
+func (d TokenDefinitions) MarshalJSON() ([]byte, error) {
+	var b bytes.Buffer
+	b.WriteByte('{')
+	for i, definition := range d {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		key, err := json.Marshal(definition.TokenType)
+		if err != nil {
+			return nil, err
+		}
+		value, err := json.Marshal(definition.Regex)
+		if err != nil {
+			return nil, err
+		}
+		b.Write(key)
+		b.WriteByte(':')
+		b.Write(value)
+	}
+	b.WriteByte('}')
+	return b.Bytes(), nil
+}
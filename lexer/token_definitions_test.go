@@ -0,0 +1,61 @@
+package lexer
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestTokenDefinitionsSet(t *testing.T) {
+	definitions := TokenDefinitions{{"if", "if"}, {"id", "[a-z]+"}}
+	definitions.Set("id", "[a-z][a-z0-9]*")
+	definitions.Set("number", "[0-9]+")
+
+	expected := TokenDefinitions{{"if", "if"}, {"id", "[a-z][a-z0-9]*"}, {"number", "[0-9]+"}}
+	if !reflect.DeepEqual(definitions, expected) {
+		t.Errorf("Expected definitions to be %v, got %v", expected, definitions)
+	}
+}
+
+func TestTokenDefinitionsUnmarshalJSON(t *testing.T) {
+	var testData = []struct {
+		input         string
+		expected      TokenDefinitions
+		expectedError bool
+	}{
+		{
+			`{"while": "while", "if": "if", "id": "[a-z]+", "(": "/("}`,
+			TokenDefinitions{{"while", "while"}, {"if", "if"}, {"id", "[a-z]+"}, {"(", "/("}},
+			false,
+		},
+		{`{"a": "a", "a": "b"}`, TokenDefinitions{{"a", "b"}}, false},
+		{`{}`, nil, false},
+		{`null`, nil, false},
+		{`["a"]`, nil, true},
+		{`{"a": 1}`, nil, true},
+	}
+
+	for _, test := range testData {
+		var got TokenDefinitions
+		err := json.Unmarshal([]byte(test.input), &got)
+		if (err != nil) != test.expectedError {
+			t.Errorf("Expected error on %v to be %v, got %v", test.input, test.expectedError, err)
+		}
+		if !test.expectedError && !reflect.DeepEqual(got, test.expected) {
+			t.Errorf("Expected %v to unmarshal into %v, got %v", test.input, test.expected, got)
+		}
+	}
+}
+
+func TestTokenDefinitionsMarshalJSON(t *testing.T) {
+	definitions := TokenDefinitions{{"while", "while"}, {"id", "[a-z]+"}, {"string", "\"[^\"]*\""}}
+	got, err := json.Marshal(definitions)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	expected := `{"while":"while","id":"[a-z]+","string":"\"[^\"]*\""}`
+	if string(got) != expected {
+		t.Errorf("Expected %v to marshal into %v, got %v", definitions, expected, string(got))
+	}
+}
@@ -1,26 +1,99 @@
 package main
 
 import (
-	"encoding/json"
+	"flag"
 	"fmt"
 	"io/ioutil"
 	"os"
+	"path/filepath"
+	"strings"
 
 	"github.com/SaurabhJha/lexpar/io"
 	"github.com/SaurabhJha/lexpar/lexer"
 	"github.com/SaurabhJha/lexpar/parser"
 )
 
+// generate implements "lexpar generate", which writes a Go package parsing like a definitions file.
+func generate(args []string) {
+	flags := flag.NewFlagSet("generate", flag.ExitOnError)
+	output := flags.String("o", "", "file to write the code to, instead of the standard output")
+	packageName := flags.String("p", "parser", "name of the package of the code")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "usage: lexpar generate [-o file] [-p package] definitions")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	definitions, err := io.ReadDefinitionsFile(flags.Arg(0))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	invalid := false
+	for _, d := range definitions.Validate() {
+		fmt.Fprintln(os.Stderr, d)
+		invalid = invalid || d.Severity == parser.SeverityError
+	}
+	if invalid {
+		os.Exit(1)
+	}
+	code, warnings, err := io.GenerateParser(definitions, *packageName, filepath.Base(flags.Arg(0)))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	for _, d := range warnings {
+		fmt.Fprintln(os.Stderr, d)
+	}
+	if *output == "" {
+		os.Stdout.Write(code)
+	} else if err := ioutil.WriteFile(*output, code, 0644); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
 func main() {
-	jsonContent, _ := ioutil.ReadFile("example.json")
-	var definitions io.DefinitionsTable
-	json.Unmarshal(jsonContent, &definitions)
+	if len(os.Args) > 1 && os.Args[1] == "generate" {
+		generate(os.Args[2:])
+		return
+	}
 
-	var tok lexer.Tokenizer
-	tok.Init(definitions.RegularExpressions)
+	path := "example.lexpar"
+	if len(os.Args) > 1 {
+		path = os.Args[1]
+	}
+	definitions, err := io.ReadDefinitionsFile(path)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
+	invalid := false
+	for _, d := range definitions.Validate() {
+		fmt.Println(d)
+		invalid = invalid || d.Severity == parser.SeverityError
+	}
+	if invalid {
+		os.Exit(1)
+	}
 
+	// The tables built from the definitions are saved to the file given as the second argument, and loaded from
+	// it on the next runs until the definitions change.
+	tablesPath := ""
+	if len(os.Args) > 2 {
+		tablesPath = os.Args[2]
+	}
+	var tok lexer.Tokenizer
 	var pars parser.Parser
-	pars.Init(definitions.Grammar)
+	if err := io.CompileDefinitions(definitions, tablesPath, &tok, &pars); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
 	for {
 		text := io.ReadFromStdin()
 		commandType := io.GetCommandType(text)
@@ -30,13 +103,35 @@ func main() {
 		case "setRegex":
 			io.ExecuteRegexCommand(text, &definitions)
 		case "persist":
-			io.Persist(&definitions)
+			io.Persist(&definitions, path)
 		case "print":
 			io.Print(&definitions)
+			fmt.Printf("Lexer automata: %+v\n", tok.Statistics())
+		case "concrete":
+			tokens, err := tok.Tokenize(strings.TrimPrefix(text, "concrete "))
+			if err != nil {
+				fmt.Println(err)
+				continue
+			}
+			tree, err := pars.ParseConcrete(tokens)
+			if err != nil {
+				fmt.Println(err)
+			}
+			io.PrintConcreteTree(tree)
+			tok.Reset()
+			pars.Reset()
 		default:
-			tokens := tok.Tokenize(text)
-			tree := pars.Parse(tokens)
-			fmt.Println(tree)
+			tokens, err := tok.Tokenize(text)
+			if err != nil {
+				fmt.Println(err)
+				continue
+			}
+			tree, err := pars.Parse(tokens)
+			if err != nil {
+				fmt.Println(err)
+			} else {
+				fmt.Println(tree)
+			}
 			tok.Reset()
 			pars.Reset()
 		}
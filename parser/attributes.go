@@ -0,0 +1,273 @@
+package parser
+
+import (
+	"fmt"
+	"strings"
+)
+
+// HeadSymbol stands for the head of a production in an AttributeRef. The symbols of the body are numbered from 0,
+// like the children of semantic rules.
+const HeadSymbol = -1
+
+// TokenAttribute is the attribute every terminal has, whose value is its lexer.Token.
+const TokenAttribute = "token"
+
+// Attribute declares an attribute of the nodes of a non terminal. Synthesized attributes are computed by the
+// productions of the non terminal, and inherited attributes by the productions having it in their body.
+type Attribute struct {
+	Symbol    string
+	Name      string
+	Inherited bool
+}
+
+// AttributeRef names an attribute of a symbol of a production, which is either HeadSymbol or the index of a body
+// symbol.
+type AttributeRef struct {
+	Symbol int
+	Name   string
+}
+
+// AttributeEquation computes the attribute Target of the production of Head with Body. Compute gets the values of
+// Arguments in order. The definition has to be L-attributed: the target is either a synthesized attribute of the
+// head, which can depend on any attribute of the production, or an inherited attribute of a body symbol, which can
+// only depend on the inherited attributes of the head, the attributes of the symbols to its left and its own
+// inherited attributes.
+type AttributeEquation struct {
+	Head      string
+	Body      []string
+	Target    AttributeRef
+	Arguments []AttributeRef
+	Compute   func(arguments []interface{}) interface{}
+}
+
+// AttributeValues holds the attributes of the nodes of a concrete syntax tree, by node and by name.
+type AttributeValues []map[string]interface{}
+
+// attributeGrammar is an L-attributed definition checked against a grammar. isInherited holds the declared
+// attributes of each non terminal, and equations the equations of each production by their target.
+type attributeGrammar struct {
+	attributes  []Attribute
+	isInherited map[grammarSymbol]map[string]bool
+	equations   map[int]map[AttributeRef]AttributeEquation
+}
+
+func formatAttributeRef(p Production, ref AttributeRef) string {
+	if ref.Symbol == HeadSymbol {
+		return fmt.Sprintf("%v.%v", p.Head, ref.Name)
+	}
+	return fmt.Sprintf("%v.%v of body symbol %v", p.Body[ref.Symbol], ref.Name, ref.Symbol)
+}
+
+// newAttributeGrammar checks that attributes and equations are an L-attributed definition over the grammar, in
+// which every production computes the synthesized attributes of its head and the inherited attributes of its body.
+func newAttributeGrammar(g Grammar, attributes []Attribute, equations []AttributeEquation) (*attributeGrammar, error) {
+	ag := attributeGrammar{attributes, make(map[grammarSymbol]map[string]bool), make(map[int]map[AttributeRef]AttributeEquation)}
+	for _, a := range attributes {
+		s := grammarSymbol(a.Symbol)
+		if g.isTerminal(s) {
+			return nil, fmt.Errorf("attribute %v of %v: %v is not a non terminal", a.Name, s, s)
+		}
+		if _, ok := ag.isInherited[s][a.Name]; ok {
+			return nil, fmt.Errorf("attribute %v of %v is declared twice", a.Name, s)
+		}
+		if ag.isInherited[s] == nil {
+			ag.isInherited[s] = make(map[string]bool)
+		}
+		ag.isInherited[s][a.Name] = a.Inherited
+	}
+
+	for _, eq := range equations {
+		number, err := g.findProduction(eq.Head, eq.Body)
+		if err != nil {
+			return nil, err
+		}
+		p := g.Productions[number]
+		if err := ag.checkEquation(g, p, eq); err != nil {
+			return nil, fmt.Errorf("equation of %v: %v", formatProduction(p), err)
+		}
+		if _, ok := ag.equations[number][eq.Target]; ok {
+			return nil, fmt.Errorf("%v is computed twice in %v", formatAttributeRef(p, eq.Target), formatProduction(p))
+		}
+		if ag.equations[number] == nil {
+			ag.equations[number] = make(map[AttributeRef]AttributeEquation)
+		}
+		ag.equations[number][eq.Target] = eq
+	}
+
+	for number, p := range g.Productions {
+		targets := make([]AttributeRef, 0)
+		for _, a := range attributes {
+			if grammarSymbol(a.Symbol) == p.Head && !a.Inherited {
+				targets = append(targets, AttributeRef{HeadSymbol, a.Name})
+			}
+		}
+		for i, s := range p.Body {
+			for _, a := range attributes {
+				if grammarSymbol(a.Symbol) == s && a.Inherited {
+					targets = append(targets, AttributeRef{i, a.Name})
+				}
+			}
+		}
+		for _, target := range targets {
+			if _, ok := ag.equations[number][target]; !ok {
+				return nil, fmt.Errorf("%v does not compute %v", formatProduction(p), formatAttributeRef(p, target))
+			}
+		}
+	}
+	return &ag, nil
+}
+
+// lookup returns whether a symbol has an attribute, and whether it is inherited. Terminals only have the
+// synthesized TokenAttribute.
+func (ag *attributeGrammar) lookup(g Grammar, s grammarSymbol, name string) (inherited bool, ok bool) {
+	if g.isTerminal(s) {
+		return false, name == TokenAttribute
+	}
+	inherited, ok = ag.isInherited[s][name]
+	return inherited, ok
+}
+
+func (ag *attributeGrammar) checkEquation(g Grammar, p Production, eq AttributeEquation) error {
+	for _, ref := range append([]AttributeRef{eq.Target}, eq.Arguments...) {
+		if ref.Symbol < HeadSymbol || ref.Symbol >= len(p.Body) {
+			return fmt.Errorf("symbol %v of attribute %v is out of range", ref.Symbol, ref.Name)
+		}
+		if _, ok := ag.lookup(g, ag.symbolOf(p, ref), ref.Name); !ok {
+			return fmt.Errorf("%v is not declared", formatAttributeRef(p, ref))
+		}
+	}
+	if eq.Compute == nil {
+		return fmt.Errorf("%v has no Compute function", formatAttributeRef(p, eq.Target))
+	}
+
+	inherited, _ := ag.lookup(g, ag.symbolOf(p, eq.Target), eq.Target.Name)
+	if eq.Target.Symbol == HeadSymbol && inherited || eq.Target.Symbol != HeadSymbol && !inherited {
+		return fmt.Errorf("%v is not a synthesized attribute of the head or an inherited attribute of the body",
+			formatAttributeRef(p, eq.Target))
+	}
+	if eq.Target.Symbol == HeadSymbol {
+		return nil
+	}
+	for _, argument := range eq.Arguments {
+		argumentIsInherited, _ := ag.lookup(g, ag.symbolOf(p, argument), argument.Name)
+		switch {
+		case argument.Symbol == HeadSymbol && argumentIsInherited:
+		case argument.Symbol >= 0 && argument.Symbol < eq.Target.Symbol:
+		case argument.Symbol == eq.Target.Symbol && argumentIsInherited:
+		default:
+			return fmt.Errorf("%v cannot depend on %v, which is not an inherited attribute of the head or an attribute "+
+				"of a symbol to its left", formatAttributeRef(p, eq.Target), formatAttributeRef(p, argument))
+		}
+	}
+	return nil
+}
+
+func (ag *attributeGrammar) symbolOf(p Production, ref AttributeRef) grammarSymbol {
+	if ref.Symbol == HeadSymbol {
+		return p.Head
+	}
+	return p.Body[ref.Symbol]
+}
+
+// attributeInstance is an attribute of a node of a concrete syntax tree.
+type attributeInstance struct {
+	node int
+	name string
+}
+
+// attributeEvaluator computes the attributes of a concrete syntax tree on demand. pending holds the attributes
+// being computed, each one depending on the next, so that finding one of them again means there is a cycle.
+type attributeEvaluator struct {
+	ag      *attributeGrammar
+	cst     ConcreteSyntaxTree
+	parent  []int
+	index   []int
+	values  AttributeValues
+	pending []attributeInstance
+}
+
+func (e *attributeEvaluator) format(instance attributeInstance) string {
+	node := e.cst.Nodes[instance.node]
+	return fmt.Sprintf("%v.%v at %d:%d", node.Symbol, instance.name, node.Start.Line, node.Start.Column)
+}
+
+// value returns the value of an attribute, computing it and the attributes it depends on first. Inherited
+// attributes are computed by the production of the parent of the node, and synthesized ones by the production of
+// the node.
+func (e *attributeEvaluator) value(instance attributeInstance) (interface{}, error) {
+	node := e.cst.Nodes[instance.node]
+	if node.Production < 0 {
+		return node.Token, nil
+	}
+	if value, ok := e.values[instance.node][instance.name]; ok {
+		return value, nil
+	}
+	for i, pending := range e.pending {
+		if pending == instance {
+			cycle := make([]string, 0, len(e.pending)-i+1)
+			for _, dependency := range append(e.pending[i:], instance) {
+				cycle = append(cycle, e.format(dependency))
+			}
+			return nil, fmt.Errorf("attributes depend on each other in a cycle: %v", strings.Join(cycle, " -> "))
+		}
+	}
+
+	owner, target := instance.node, AttributeRef{HeadSymbol, instance.name}
+	if e.ag.isInherited[grammarSymbol(node.Symbol)][instance.name] {
+		owner, target = e.parent[instance.node], AttributeRef{e.index[instance.node], instance.name}
+		if owner == noNode {
+			return nil, fmt.Errorf("%v is inherited by the root", e.format(instance))
+		}
+	}
+	eq := e.ag.equations[e.cst.Nodes[owner].Production][target]
+
+	e.pending = append(e.pending, instance)
+	arguments := make([]interface{}, len(eq.Arguments))
+	for i, argument := range eq.Arguments {
+		argumentNode := owner
+		if argument.Symbol != HeadSymbol {
+			argumentNode = e.cst.Nodes[owner].Children[argument.Symbol]
+		}
+		value, err := e.value(attributeInstance{argumentNode, argument.Name})
+		if err != nil {
+			return nil, err
+		}
+		arguments[i] = value
+	}
+	e.pending = e.pending[:len(e.pending)-1]
+
+	value := eq.Compute(arguments)
+	if e.values[instance.node] == nil {
+		e.values[instance.node] = make(map[string]interface{})
+	}
+	e.values[instance.node][instance.name] = value
+	return value, nil
+}
+
+// evaluate computes every declared attribute of the nodes below the root, in the order of the nodes and of the
+// declarations.
+func (e *attributeEvaluator) evaluate() error {
+	e.parent = make([]int, len(e.cst.Nodes))
+	e.index = make([]int, len(e.cst.Nodes))
+	e.values = make(AttributeValues, len(e.cst.Nodes))
+	e.parent[e.cst.Root] = noNode
+	nodes := []int{e.cst.Root}
+	for i := 0; i < len(nodes); i++ {
+		for j, child := range e.cst.Nodes[nodes[i]].Children {
+			e.parent[child], e.index[child] = nodes[i], j
+			nodes = append(nodes, child)
+		}
+	}
+
+	for _, node := range nodes {
+		for _, a := range e.ag.attributes {
+			if a.Symbol != e.cst.Nodes[node].Symbol || e.cst.Nodes[node].Production < 0 {
+				continue
+			}
+			if _, err := e.value(attributeInstance{node, a.Name}); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
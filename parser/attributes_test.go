@@ -0,0 +1,193 @@
+package parser
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/SaurabhJha/lexpar/lexer"
+)
+
+// declarationsGrammar is the grammar of declarations like "int a , b", whose type is passed down the list of names
+// with an inherited attribute.
+var declarationsGrammar = Grammar{
+	Start: "decl'",
+	Productions: []Production{
+		{Head: "decl'", Body: []grammarSymbol{"decl"}},
+		{Head: "decl", Body: []grammarSymbol{"type", "list"}},
+		{Head: "type", Body: []grammarSymbol{"int"}},
+		{Head: "type", Body: []grammarSymbol{"float"}},
+		{Head: "list", Body: []grammarSymbol{"list", ",", "id"}},
+		{Head: "list", Body: []grammarSymbol{"id"}},
+	},
+}
+
+var declarationsAttributes = []Attribute{
+	{"decl'", "entries", false},
+	{"decl", "entries", false},
+	{"type", "name", false},
+	{"list", "type", true},
+	{"list", "entries", false},
+}
+
+func lexemeOf(arguments []interface{}) interface{} {
+	return arguments[0].(lexer.Token).Lexeme
+}
+
+func copyArgument(arguments []interface{}) interface{} {
+	return arguments[0]
+}
+
+var declarationsEquations = []AttributeEquation{
+	{"decl'", []string{"decl"}, AttributeRef{HeadSymbol, "entries"}, []AttributeRef{{0, "entries"}}, copyArgument},
+	{"decl", []string{"type", "list"}, AttributeRef{HeadSymbol, "entries"}, []AttributeRef{{1, "entries"}}, copyArgument},
+	{"decl", []string{"type", "list"}, AttributeRef{1, "type"}, []AttributeRef{{0, "name"}}, copyArgument},
+	{"type", []string{"int"}, AttributeRef{HeadSymbol, "name"}, []AttributeRef{{0, TokenAttribute}}, lexemeOf},
+	{"type", []string{"float"}, AttributeRef{HeadSymbol, "name"}, []AttributeRef{{0, TokenAttribute}}, lexemeOf},
+	{"list", []string{"list", ",", "id"}, AttributeRef{0, "type"}, []AttributeRef{{HeadSymbol, "type"}}, copyArgument},
+	{"list", []string{"list", ",", "id"}, AttributeRef{HeadSymbol, "entries"},
+		[]AttributeRef{{0, "entries"}, {2, TokenAttribute}, {HeadSymbol, "type"}},
+		func(arguments []interface{}) interface{} {
+			entry := arguments[1].(lexer.Token).Lexeme + ":" + arguments[2].(string)
+			return append(arguments[0].([]string), entry)
+		}},
+	{"list", []string{"id"}, AttributeRef{HeadSymbol, "entries"}, []AttributeRef{{0, TokenAttribute}, {HeadSymbol, "type"}},
+		func(arguments []interface{}) interface{} {
+			return []string{arguments[0].(lexer.Token).Lexeme + ":" + arguments[1].(string)}
+		}},
+}
+
+func tokensOf(input string) []lexer.Token {
+	tokens := make([]lexer.Token, 0)
+	for i, lexeme := range strings.Fields(input) {
+		tokenType := lexeme
+		if lexeme != "int" && lexeme != "float" && lexeme != "," {
+			tokenType = "id"
+		}
+		tokens = append(tokens, lexer.Token{TokenType: tokenType, Lexeme: lexeme, Start: lexer.Position{Line: 1, Column: i + 1}})
+	}
+	return tokens
+}
+
+func TestEvaluateAttributes(t *testing.T) {
+	var testData = []struct {
+		input           string
+		expectedEntries []string
+	}{
+		{"int a", []string{"a:int"}},
+		{"float x , y , z", []string{"x:float", "y:float", "z:float"}},
+	}
+
+	var P Parser
+	if err := P.Init(declarationsGrammar); err != nil {
+		t.Fatalf("Expected parser to compile, got %v", err)
+	}
+	if err := P.DefineAttributes(declarationsAttributes, declarationsEquations); err != nil {
+		t.Fatalf("Expected attributes to be defined, got %v", err)
+	}
+	for _, test := range testData {
+		cst, err := P.ParseConcrete(tokensOf(test.input))
+		if err != nil {
+			t.Fatalf("Expected %v to be parsed, got %v", test.input, err)
+		}
+		values, err := P.EvaluateAttributes(cst)
+		if err != nil {
+			t.Errorf("Expected attributes of %v to be computed, got %v", test.input, err)
+		} else if got := values[cst.Root]["entries"]; !reflect.DeepEqual(got, test.expectedEntries) {
+			t.Errorf("Expected entries %v on input %v, got %v", test.expectedEntries, test.input, got)
+		}
+		P.Reset()
+	}
+}
+
+func TestDefineAttributesErrors(t *testing.T) {
+	withEquation := func(eq AttributeEquation) []AttributeEquation {
+		return append(append([]AttributeEquation{}, declarationsEquations...), eq)
+	}
+	var testData = []struct {
+		attributes    []Attribute
+		equations     []AttributeEquation
+		expectedError string
+	}{
+		{
+			append(declarationsAttributes, Attribute{"id", "type", true}),
+			declarationsEquations,
+			"attribute type of id: id is not a non terminal",
+		},
+		{
+			append(declarationsAttributes, Attribute{"list", "type", false}),
+			declarationsEquations,
+			"attribute type of list is declared twice",
+		},
+		{
+			declarationsAttributes,
+			declarationsEquations[1:],
+			"decl' -> decl does not compute decl'.entries",
+		},
+		{
+			declarationsAttributes,
+			withEquation(AttributeEquation{"list", []string{"id"}, AttributeRef{HeadSymbol, "entries"}, nil, copyArgument}),
+			"list.entries is computed twice in list -> id",
+		},
+		{
+			declarationsAttributes,
+			withEquation(AttributeEquation{"list", []string{"id"}, AttributeRef{HeadSymbol, "size"}, nil, copyArgument}),
+			"equation of list -> id: list.size is not declared",
+		},
+		{
+			declarationsAttributes,
+			withEquation(AttributeEquation{"list", []string{"id"}, AttributeRef{HeadSymbol, "type"}, nil, copyArgument}),
+			"equation of list -> id: list.type is not a synthesized attribute of the head or an inherited attribute of the body",
+		},
+		{
+			declarationsAttributes,
+			withEquation(AttributeEquation{"decl", []string{"type", "list"}, AttributeRef{1, "type"},
+				[]AttributeRef{{1, "entries"}}, copyArgument}),
+			"equation of decl -> type list: list.type of body symbol 1 cannot depend on list.entries of body symbol 1, " +
+				"which is not an inherited attribute of the head or an attribute of a symbol to its left",
+		},
+		{
+			declarationsAttributes,
+			withEquation(AttributeEquation{"list", []string{"id"}, AttributeRef{HeadSymbol, "entries"},
+				[]AttributeRef{{1, "type"}}, copyArgument}),
+			"equation of list -> id: symbol 1 of attribute type is out of range",
+		},
+		{
+			declarationsAttributes,
+			withEquation(AttributeEquation{"list", []string{"(", "id", ")"}, AttributeRef{HeadSymbol, "entries"}, nil, copyArgument}),
+			"grammar has no production list -> ( id )",
+		},
+	}
+
+	var P Parser
+	if err := P.Init(declarationsGrammar); err != nil {
+		t.Fatalf("Expected parser to compile, got %v", err)
+	}
+	for i, test := range testData {
+		err := P.DefineAttributes(test.attributes, test.equations)
+		if err == nil || err.Error() != test.expectedError {
+			t.Errorf("Expected error %q for definition %v, got %v", test.expectedError, i, err)
+		}
+	}
+}
+
+func TestEvaluateAttributesCycle(t *testing.T) {
+	attributes := append(declarationsAttributes, Attribute{"decl", "size", false}, Attribute{"decl", "count", false})
+	equations := append(append([]AttributeEquation{}, declarationsEquations...),
+		AttributeEquation{"decl", []string{"type", "list"}, AttributeRef{HeadSymbol, "size"}, []AttributeRef{{HeadSymbol, "count"}}, copyArgument},
+		AttributeEquation{"decl", []string{"type", "list"}, AttributeRef{HeadSymbol, "count"}, []AttributeRef{{HeadSymbol, "size"}}, copyArgument})
+
+	var P Parser
+	if err := P.Init(declarationsGrammar); err != nil {
+		t.Fatalf("Expected parser to compile, got %v", err)
+	}
+	if err := P.DefineAttributes(attributes, equations); err != nil {
+		t.Fatalf("Expected attributes to be defined, got %v", err)
+	}
+	cst, _ := P.ParseConcrete(tokensOf("int a"))
+	_, err := P.EvaluateAttributes(cst)
+	expectedError := "attributes depend on each other in a cycle: decl.size at 1:1 -> decl.count at 1:1 -> decl.size at 1:1"
+	if err == nil || err.Error() != expectedError {
+		t.Errorf("Expected error %q, got %v", expectedError, err)
+	}
+}
@@ -1,137 +1,189 @@
 package parser
 
 import (
-	"fmt"
-	"reflect"
+	"sort"
+	"strconv"
+	"strings"
 
 	"github.com/SaurabhJha/lexpar/lexer"
 )
 
+// lrItem is the core of an LR(1) item: a production, referred to by its number in the grammar, and the position
+// of the dot in its body. Lookaheads are kept by the item set, so that items are small and can be used as map keys.
 type lrItem struct {
-	g         Grammar
-	p         Production
-	pos       int
-	followSet map[grammarSymbol]bool
+	production int
+	pos        int
 }
 
-func (l lrItem) getNextSymbol() grammarSymbol {
-	if l.pos == len(l.p.Body) {
+func (l lrItem) getNextSymbol(g Grammar) grammarSymbol {
+	body := g.Productions[l.production].Body
+	if l.pos >= len(body) {
 		return ""
 	}
-	return l.p.Body[l.pos]
+	return body[l.pos]
 }
 
-func (l lrItem) getNextToNextSymbol() grammarSymbol {
-	if l.pos >= len(l.p.Body)-1 {
-		return ""
-	}
-	return l.p.Body[l.pos+1]
-}
-
-func (l lrItem) getNextItem(s grammarSymbol) lrItem {
-	if l.pos >= len(l.p.Body) {
-		return lrItem{}
+// format writes the item the way textbooks do, like "expr -> expr . + term".
+func (l lrItem) format(g Grammar) string {
+	p := g.Productions[l.production]
+	var b strings.Builder
+	b.WriteString(string(p.Head))
+	b.WriteString(" ->")
+	for i, s := range p.Body {
+		if i == l.pos {
+			b.WriteString(" .")
+		}
+		b.WriteByte(' ')
+		b.WriteString(string(s))
 	}
-	if l.p.Body[l.pos] != s {
-		return lrItem{}
+	if l.pos == len(p.Body) {
+		b.WriteString(" .")
 	}
-	return lrItem{l.g, l.p, l.pos + 1, l.followSet}
+	return b.String()
 }
 
-func (l lrItem) empty() bool {
-	return reflect.DeepEqual(
-		l, lrItem{
-			Grammar{nil, ""},
-			Production{"", nil, SemanticRule{"", "", nil}},
-			0,
-			nil,
-		},
-	)
+func (l lrItem) getNextItem() lrItem {
+	return lrItem{l.production, l.pos + 1}
 }
 
+// lrItemSet is a set of LR(1) items. Items with the same core are stored once, with the union of their
+// lookaheads.
 type lrItemSet struct {
-	itemSet []lrItem
+	items      []lrItem
+	lookaheads map[lrItem]setOfSymbols
 }
 
 func (ls *lrItemSet) has(l lrItem) bool {
-	for _, item := range ls.itemSet {
-		if reflect.DeepEqual(item, l) {
-			return true
-		}
-	}
-	return false
+	_, ok := ls.lookaheads[l]
+	return ok
 }
 
-func (ls *lrItemSet) equals(ols *lrItemSet) bool {
-	for _, item := range ls.itemSet {
-		if !ols.has(item) {
-			return false
-		}
+// add adds an item with the given lookaheads and tells whether the set changed.
+func (ls *lrItemSet) add(l lrItem, lookaheads setOfSymbols) bool {
+	if ls.lookaheads == nil {
+		ls.lookaheads = make(map[lrItem]setOfSymbols)
 	}
+	existing, ok := ls.lookaheads[l]
+	if !ok {
+		existing = make(setOfSymbols)
+		ls.lookaheads[l] = existing
+		ls.items = append(ls.items, l)
+	}
+	before := len(existing)
+	existing.unionWith(&lookaheads)
+	return !ok || len(existing) != before
+}
+
+func (ls *lrItemSet) getNextSymbols(g Grammar) setOfSymbols {
+	s := make(setOfSymbols)
 
-	for _, item := range ols.itemSet {
-		if !ls.has(item) {
-			return false
+	for _, l := range ls.items {
+		if l.getNextSymbol(g) != "" {
+			s.add(l.getNextSymbol(g))
 		}
 	}
 
-	return true
+	return s
 }
 
-func (ls *lrItemSet) add(l lrItem) {
-	if !ls.has(l) {
-		(*ls).itemSet = append((*ls).itemSet, l)
+func (ls *lrItemSet) mergeWith(otherLs *lrItemSet) {
+	for _, l := range otherLs.items {
+		ls.add(l, otherLs.lookaheads[l])
 	}
 }
 
-func (ls *lrItemSet) getNextSymbols() setOfSymbols {
-	s := make(setOfSymbols)
-
-	for _, l := range ls.itemSet {
-		if l.getNextSymbol() != "" {
-			s.add(l.getNextSymbol())
+// getNextKernel returns the items reached by moving the dot over s. These are the kernel items of the next item
+// set, whose closure only needs to be computed when the item set turns out to be new.
+func (ls *lrItemSet) getNextKernel(g Grammar, s grammarSymbol) lrItemSet {
+	var kernel lrItemSet
+	for _, l := range ls.items {
+		if l.getNextSymbol(g) == s {
+			kernel.add(l.getNextItem(), ls.lookaheads[l])
 		}
 	}
+	return kernel
+}
 
-	return s
+// key returns a string which is the same for two item sets if and only if they have the same items with the same
+// lookaheads.
+func (ls *lrItemSet) key() string {
+	return ls.computeKey(true)
 }
 
-func (ls *lrItemSet) mergeWith(otherLs *lrItemSet) {
-	for _, l := range otherLs.itemSet {
-		if !ls.has(l) {
-			ls.add(l)
+// coreKey returns a string which is the same for two item sets if and only if they have the same items, ignoring
+// lookaheads.
+func (ls *lrItemSet) coreKey() string {
+	return ls.computeKey(false)
+}
+
+func (ls *lrItemSet) computeKey(withLookaheads bool) string {
+	items := make([]lrItem, len(ls.items))
+	copy(items, ls.items)
+	sort.Slice(items, func(i, j int) bool {
+		if items[i].production != items[j].production {
+			return items[i].production < items[j].production
+		}
+		return items[i].pos < items[j].pos
+	})
+
+	var b strings.Builder
+	for _, l := range items {
+		b.WriteString(strconv.Itoa(l.production))
+		b.WriteByte('.')
+		b.WriteString(strconv.Itoa(l.pos))
+		if withLookaheads {
+			for _, s := range ls.lookaheads[l].sorted() {
+				b.WriteByte(0)
+				b.WriteString(string(s))
+			}
 		}
+		b.WriteByte(1)
 	}
+	return b.String()
 }
 
-func (l lrItem) computeClosureSet() lrItemSet {
-	ls := lrItemSet{[]lrItem{l}}
-
-	if l.g.isTerminal(l.getNextSymbol()) {
-		return ls
+// getReductions returns the productions which can be reduced in the item set, by lookahead.
+func (ls *lrItemSet) getReductions(g Grammar) map[grammarSymbol][]int {
+	reductions := make(map[grammarSymbol][]int)
+	for _, l := range ls.items {
+		if l.getNextSymbol(g) != "" {
+			continue
+		}
+		for s := range ls.lookaheads[l] {
+			reductions[s] = append(reductions[s], l.production)
+		}
 	}
+	return reductions
+}
 
+// computeClosureSet adds to a kernel the items of every production that can be started next, along with their
+// lookaheads. Items are visited again whenever their lookaheads grow, until nothing changes.
+func (gi *grammarIndex) computeClosureSet(kernel lrItemSet) lrItemSet {
+	var ls lrItemSet
 	q := make(queueOfItems, 0, 10)
-	q.enqueue(l)
+	for _, l := range kernel.items {
+		ls.add(l, kernel.lookaheads[l])
+		q.enqueue(l)
+	}
+
 	for !q.empty() {
 		currentItem := q.dequeue()
-		nextSymbol := currentItem.getNextSymbol()
-		if !l.g.isTerminal(nextSymbol) {
-			// We have not encountered this non terminal before. Add its productions to the item set
-			// and to the queue. We add them to queue so that items reachable from those can be added
-			// later.
-			followSetOfNextItem := make(map[grammarSymbol]bool)
-			if nextToNextSymbol := currentItem.getNextToNextSymbol(); nextToNextSymbol != "" {
-				followSetOfNextItem = currentItem.g.computeFirstSet(nextToNextSymbol)
-			} else {
-				followSetOfNextItem = currentItem.followSet
+		nextSymbol := currentItem.getNextSymbol(gi.g)
+		if nextSymbol == "" || gi.isTerminal(nextSymbol) {
+			continue
+		}
+
+		// The lookaheads of the added items are what can follow nextSymbol: the FIRST set of the rest of the body,
+		// and the lookaheads of the current item if the rest of the body can be empty.
+		rest := gi.getFirstSetOfRest(currentItem)
+		for _, p := range gi.productionsOf[nextSymbol] {
+			nextItem := lrItem{p, 0}
+			changed := ls.add(nextItem, rest.firstSet)
+			if rest.nullable && ls.add(nextItem, ls.lookaheads[currentItem]) {
+				changed = true
 			}
-			for _, p := range l.g.getProductionsOfSymbol(nextSymbol) {
-				nextItem := lrItem{l.g, p, 0, followSetOfNextItem}
-				if !ls.has(nextItem) {
-					q.enqueue(nextItem)
-					ls.add(nextItem)
-				}
+			if changed {
+				q.enqueue(nextItem)
 			}
 		}
 	}
@@ -139,19 +191,163 @@ func (l lrItem) computeClosureSet() lrItemSet {
 	return ls
 }
 
-func (ls *lrItemSet) getNextItemSet(s grammarSymbol) lrItemSet {
-	var nextLs lrItemSet
-	for _, l := range ls.itemSet {
-		if nextItem := l.getNextItem(s); !nextItem.empty() {
-			nextItemSet := nextItem.computeClosureSet()
-			nextLs.mergeWith(&nextItemSet)
+type state uint
+
+// lrAutomaton is the collection of item sets of a grammar along with the transitions between them. State i is
+// the item set itemSets[i].
+type lrAutomaton struct {
+	itemSets []lrItemSet
+	gotos    []map[grammarSymbol]state
+}
+
+// computeCanonicalCollection builds the canonical LR(1) automaton of the grammar.
+func (gi *grammarIndex) computeCanonicalCollection(startProduction int) lrAutomaton {
+	var startKernel lrItemSet
+	startKernel.add(lrItem{startProduction, 0}, setOfSymbols{"$": true})
+	var seen seenLrItemSets
+	seen.getStateNumber(startKernel)
+
+	// States are numbered in the order they are found, so going through them in order is a breadth first search.
+	var a lrAutomaton
+	for currentState := state(0); int(currentState) < len(seen.kernels); currentState++ {
+		currentItemSet := gi.computeClosureSet(seen.kernels[currentState])
+		gotos := make(map[grammarSymbol]state)
+		for _, symbol := range currentItemSet.getNextSymbols(gi.g).sorted() {
+			gotos[symbol], _ = seen.getStateNumber(currentItemSet.getNextKernel(gi.g, symbol))
+		}
+		a.itemSets = append(a.itemSets, currentItemSet)
+		a.gotos = append(a.gotos, gotos)
+	}
+	return a
+}
+
+// mergeCores builds the LALR(1) automaton by merging the states of an LR(1) automaton which have the same items
+// once lookaheads are ignored. Merging never adds shift-reduce conflicts, but it can add reduce-reduce conflicts,
+// which are returned. The states are merged after the LR(1) automaton is complete rather than as they are found,
+// because telling the conflicts of the merge from those of the LR(1) states needs the unmerged states.
+func (a *lrAutomaton) mergeCores(g Grammar) (lrAutomaton, []Conflict) {
+	mergedState := make([]state, len(a.itemSets))
+	numbers := make(map[string]state)
+	var merged lrAutomaton
+	for s := range a.itemSets {
+		key := a.itemSets[s].coreKey()
+		number, ok := numbers[key]
+		if !ok {
+			number = state(len(merged.itemSets))
+			numbers[key] = number
+			merged.itemSets = append(merged.itemSets, lrItemSet{})
+		}
+		mergedState[s] = number
+		merged.itemSets[number].mergeWith(&a.itemSets[s])
+	}
+
+	merged.gotos = make([]map[grammarSymbol]state, len(merged.itemSets))
+	conflictFree := make([]map[grammarSymbol]bool, len(merged.itemSets))
+	for s := range a.itemSets {
+		m := mergedState[s]
+		if merged.gotos[m] == nil {
+			merged.gotos[m] = make(map[grammarSymbol]state)
+			conflictFree[m] = make(map[grammarSymbol]bool)
+		}
+		for symbol, next := range a.gotos[s] {
+			merged.gotos[m][symbol] = mergedState[next]
+		}
+		for symbol, productions := range a.itemSets[s].getReductions(g) {
+			if len(productions) > 1 {
+				conflictFree[m][symbol] = false
+			} else if _, ok := conflictFree[m][symbol]; !ok {
+				conflictFree[m][symbol] = true
+			}
+		}
+	}
+
+	conflicts := make([]Conflict, 0)
+	for m := range merged.itemSets {
+		reductions := merged.itemSets[m].getReductions(g)
+		for _, symbol := range getReductionSymbols(reductions) {
+			if len(reductions[symbol]) > 1 && conflictFree[m][symbol] {
+				conflict := merged.describeConflict(g, state(m), symbol, reductions[symbol])
+				conflict.IntroducedByMerge = true
+				conflicts = append(conflicts, conflict)
+			}
 		}
 	}
+	return merged, conflicts
+}
 
-	return nextLs
+func getReductionSymbols(reductions map[grammarSymbol][]int) []grammarSymbol {
+	symbols := make(setOfSymbols)
+	for symbol := range reductions {
+		symbols.add(symbol)
+	}
+	return symbols.sorted()
 }
 
-type state uint
+// describeConflict lists the items of a state which ask for different actions on a symbol.
+func (a *lrAutomaton) describeConflict(g Grammar, s state, symbol grammarSymbol, productions []int) Conflict {
+	sort.Ints(productions)
+	conflict := Conflict{ReduceReduce, int(s), symbol, productions, nil, false}
+	if _, ok := a.gotos[s][symbol]; ok {
+		conflict.Kind = ShiftReduce
+	}
+
+	itemSet := &a.itemSets[s]
+	for _, item := range itemSet.items {
+		nextSymbol := item.getNextSymbol(g)
+		lookaheads := itemSet.lookaheads[item]
+		if nextSymbol == symbol || (nextSymbol == "" && lookaheads.has(symbol)) {
+			conflict.Items = append(conflict.Items, item.format(g))
+		}
+	}
+	sort.Strings(conflict.Items)
+	return conflict
+}
+
+// buildParsingTable adds the shift, reduce and accept moves of every state of the automaton to a parsing table.
+// Shift-reduce conflicts are settled by precedence when the grammar declares it. The remaining entries with more
+// than one possible action are returned as conflicts, and only get the shift move if any.
+func (a *lrAutomaton) buildParsingTable(gi *grammarIndex, startProduction int) (parsingTable, []Conflict) {
+	g := gi.g
+	table := make(parsingTable)
+	conflicts := make([]Conflict, 0)
+	for i := range a.itemSets {
+		currentState := state(i)
+
+		// Add shift moves.
+		for _, symbol := range a.itemSets[i].getNextSymbols(g).sorted() {
+			table.addShiftMove(currentState, a.gotos[i][symbol], symbol)
+		}
+
+		// Add reduce and accept moves.
+		reductions := a.itemSets[i].getReductions(g)
+		for _, symbol := range getReductionSymbols(reductions) {
+			productions := reductions[symbol]
+			if len(productions) > 1 {
+				conflicts = append(conflicts, a.describeConflict(g, currentState, symbol, productions))
+				continue
+			}
+			if _, ok := a.gotos[i][symbol]; ok {
+				switch gi.resolveShiftReduce(productions[0], symbol) {
+				case unresolved:
+					conflicts = append(conflicts, a.describeConflict(g, currentState, symbol, productions))
+					continue
+				case resolveShift:
+					continue
+				case resolveError:
+					// A non associative operator following itself is a syntax error.
+					delete(table[currentState], symbol)
+					continue
+				}
+			}
+			if productions[0] == startProduction && symbol == "$" {
+				table.addAcceptMove(currentState)
+			} else {
+				table.addReduceMove(currentState, productions[0], symbol)
+			}
+		}
+	}
+	return table, conflicts
+}
 
 type parserActionType int
 
@@ -172,18 +368,6 @@ func (p *parsingTable) addShiftMove(s state, e state, gs grammarSymbol) {
 	if (*p)[s] == nil {
 		(*p)[s] = make(map[grammarSymbol]parserAction)
 	}
-
-	if existingAction, ok := (*p)[s][gs]; ok {
-		switch existingAction.actionType {
-		case shift:
-			panic(fmt.Sprintf("Shift-shift conflict on state %v and input %v", s, gs))
-		case reduce:
-			panic(fmt.Sprintf("Shift-reduce conflict on state %v and input %v", s, gs))
-		case accept:
-			panic(fmt.Sprintf("Accept-shift conflict on state %v and input %v", s, gs))
-		}
-	}
-
 	(*p)[s][gs] = parserAction{shift, int(e)}
 }
 
@@ -191,18 +375,6 @@ func (p *parsingTable) addReduceMove(s state, productionNumber int, gs grammarSy
 	if (*p)[s] == nil {
 		(*p)[s] = make(map[grammarSymbol]parserAction)
 	}
-
-	if existingAction, ok := (*p)[s][gs]; ok {
-		switch existingAction.actionType {
-		case shift:
-			panic(fmt.Sprintf("Shift-reduce conflict on state %v and input %v", s, gs))
-		case reduce:
-			panic(fmt.Sprintf("Reduce-reduce conflict on state %v and input %v", s, gs))
-		case accept:
-			panic(fmt.Sprintf("Accept-reduce conflict on state %v and input %v", s, gs))
-		}
-	}
-
 	(*p)[s][gs] = parserAction{reduce, productionNumber}
 }
 
@@ -210,11 +382,6 @@ func (p *parsingTable) addAcceptMove(s state) {
 	if (*p)[s] == nil {
 		(*p)[s] = make(map[grammarSymbol]parserAction)
 	}
-
-	if _, ok := (*p)[s]["$"]; ok {
-		panic(fmt.Sprintf("Cannot add accept move, already an action on %v and %v", s, "$"))
-	}
-
 	(*p)[s]["$"] = parserAction{accept, 0}
 }
 
@@ -225,13 +392,43 @@ type parser struct {
 	dead     bool
 	accepted bool
 	ast      SyntaxGraph
-	gStack   graphStack
+	// gStack holds the nodes of the symbols on the parser stack, which are nodes of cst when building concrete
+	// syntax trees, indices of values when computing values and nodes of ast otherwise.
+	gStack graphStack
+	// ends holds where the text of each symbol on the parser stack ends, for the ends of the nodes of ast.
+	ends endStack
+	errs []ParseError
+	// recovering counts the tokens left to shift after an error before the parser reports errors again.
+	recovering int
+	mode       parseMode
+	cst        ConcreteSyntaxTree
+	share      bool
+	numbers    valueNumbers
+	actions    map[int]Action
+	values     []interface{}
+	attributes *attributeGrammar
 }
 
+// parseMode tells what the parser builds on reductions.
+type parseMode int
+
+const (
+	buildSyntaxGraph parseMode = iota
+	buildConcreteTree
+	computeValues
+)
+
+// errorSymbol is the terminal standing for the erroneous part of the input in error productions.
+const errorSymbol grammarSymbol = "error"
+
+// tokensToResync is how many tokens have to be shifted after an error for the parser to be back in sync. Errors
+// found before that are taken as part of the first one and are not reported.
+const tokensToResync = 3
+
 func (ps *parser) init(t parsingTable, g Grammar) {
 	stack := make(parserStack, 0, 10)
 	stack.push(0)
-	*ps = parser{g, t, stack, false, false, SyntaxGraph{}, graphStack{}}
+	*ps = parser{g: g, table: t, pStack: stack, numbers: newValueNumbers(), actions: make(map[int]Action)}
 }
 
 func (ps *parser) move(token lexer.Token) {
@@ -240,13 +437,7 @@ func (ps *parser) move(token lexer.Token) {
 		return
 	}
 
-	if _, ok := ps.table[ps.pStack.top()]; !ok {
-		ps.dead = true
-		return
-	}
-
-	if _, ok := ps.table[ps.pStack.top()][tokenType]; !ok {
-		ps.dead = true
+	if _, ok := ps.table[ps.pStack.top()][tokenType]; !ok && !ps.recover(token) {
 		return
 	}
 
@@ -264,36 +455,341 @@ func (ps *parser) move(token lexer.Token) {
 		nextState := state(nextParserAction.number)
 		ps.pStack.push(nextState)
 
-		// SDD execution
-		rule := prod.Rule
-		if !rule.isEmpty() {
-			stackContents := make([]int, 0, 5)
-			for range prod.Body {
-				stackContents = append(stackContents, ps.gStack.pop())
-			}
-			switch rule.Type {
-			case "tree":
-				rootNodeIndex := ps.ast.createNewNode(rule.RootLabel)
-				for childIdx := len(rule.Children) - 1; childIdx >= 0; childIdx-- {
-					childNodeIndex := stackContents[rule.Children[childIdx]]
-					ps.ast.addEdge(rootNodeIndex, childNodeIndex)
-				}
-				ps.gStack.push(rootNodeIndex)
-			case "copy":
-				ps.gStack.push(stackContents[rule.Children[0]])
-			}
+		// SDD execution. The graph nodes of the body symbols are taken off the graph stack in body order, so
+		// that rule.Children index the body.
+		stackContents := make([]int, len(prod.Body))
+		for i := len(prod.Body) - 1; i >= 0; i-- {
+			stackContents[i] = ps.gStack.pop()
+		}
+		end := ps.ends.popEnd(len(prod.Body), token.Start)
+		ps.gStack.push(ps.reduceNode(prod, prodNumber, stackContents, token, end))
+		ps.ends.push(end)
+
+		// LALR(1) tables and precedence declarations can reduce before finding out that the input is wrong.
+		if _, ok := ps.table[ps.pStack.top()][tokenType]; !ok && !ps.recover(token) {
+			return
 		}
 	}
 
 	switch nextParserAction := ps.table[ps.pStack.top()][tokenType]; nextParserAction.actionType {
 	case accept:
 		ps.accepted = true
+		if ps.mode != buildSyntaxGraph {
+			ps.addStartNode(token)
+		}
 	case shift:
 		nextState := state(ps.table[ps.pStack.top()][tokenType].number)
 		ps.pStack.push(nextState)
-		newNode := ps.ast.createNewNode(token.Lexeme)
-		ps.gStack.push(newNode)
+		ps.gStack.push(ps.newLeaf(token))
+		ps.ends.push(token.End)
+		if ps.recovering > 0 {
+			ps.recovering--
+		}
+	}
+}
+
+// reduceNode returns the node of a production over the nodes of its body, built the way the parse mode asks for.
+// The text of the body ends at end.
+func (ps *parser) reduceNode(p Production, number int, stackContents []int, token lexer.Token, end lexer.Position) int {
+	switch ps.mode {
+	case buildConcreteTree:
+		return ps.cst.addProductionNode(p, number, stackContents, token.Start)
+	case computeValues:
+		return ps.runAction(p, number, stackContents)
+	default:
+		return ps.applyRule(p.Rule, stackContents, token, end)
+	}
+}
+
+// addStartNode adds the node of the production of the start symbol to a concrete syntax tree, or computes its
+// value. The parser accepts instead of reducing by it, so it is added on accepting.
+func (ps *parser) addStartNode(token lexer.Token) {
+	for i, p := range ps.g.Productions {
+		if p.Head != ps.g.Start {
+			continue
+		}
+		stackContents := make([]int, len(p.Body))
+		for j := len(p.Body) - 1; j >= 0; j-- {
+			stackContents[j] = ps.gStack.pop()
+		}
+		end := ps.ends.popEnd(len(p.Body), token.Start)
+		ps.gStack.push(ps.reduceNode(p, i, stackContents, token, end))
+		ps.ends.push(end)
+		return
+	}
+}
+
+// applyRule runs the semantic rule of a production on the nodes of its body and returns the node of its head.
+// Nodes built by the rule end where the text of the body ends.
+func (ps *parser) applyRule(rule SemanticRule, stackContents []int, token lexer.Token, end lexer.Position) int {
+	switch rule.Type {
+	case "":
+		// A production without a rule copies its first child up.
+		if len(stackContents) > 0 {
+			return stackContents[0]
+		}
+		return noNode
+	case "tree":
+		// The tree starts where its leftmost child starts, or where the next token starts if the body is empty.
+		position := token.Start
+		for _, node := range stackContents {
+			if node != noNode {
+				position = ps.ast.NodePosition[node]
+				break
+			}
+		}
+		children := make([]int, 0, len(rule.Children))
+		for _, childIdx := range rule.Children {
+			if childNodeIndex := stackContents[childIdx]; childNodeIndex != noNode {
+				children = append(children, childNodeIndex)
+			}
+		}
+		label := ps.resolveLabel(rule.RootLabel, stackContents)
+		return ps.newNode(label, position, end, children, ps.resolveAttributes(rule.Attributes, stackContents))
+	case "leaf":
+		// The leaf takes the place of its first child, keeping the child's label as its lexeme.
+		position := token.Start
+		attributes := ps.resolveAttributes(rule.Attributes, stackContents)
+		if child := stackContents[rule.Children[0]]; child != noNode {
+			position = ps.ast.NodePosition[child]
+			attributes["lexeme"] = ps.ast.NodeLabel[child]
+		}
+		return ps.newNode(ps.resolveLabel(rule.RootLabel, stackContents), position, end, nil, attributes)
+	case "copy":
+		return stackContents[rule.Children[0]]
+	case "append":
+		// The first child is a list which takes the other children as its last ones.
+		list := stackContents[rule.Children[0]]
+		if list == noNode {
+			return noNode
+		}
+		children := make([]int, 0, len(rule.Children)-1)
+		for _, childIdx := range rule.Children[1:] {
+			if childNodeIndex := stackContents[childIdx]; childNodeIndex != noNode {
+				children = append(children, childNodeIndex)
+			}
+		}
+		return ps.appendToNode(list, children, end)
+	default:
+		return noNode
+	}
+}
+
+// parseChildReference returns the body symbol a value like "$1" refers to. Other values refer to no symbol.
+func parseChildReference(value string) (int, bool) {
+	if len(value) < 2 || value[0] != '$' {
+		return 0, false
+	}
+	child, err := strconv.Atoi(value[1:])
+	if err != nil || child < 0 {
+		return 0, false
+	}
+	return child, true
+}
+
+// resolveLabel returns the label of the node of a body symbol for a value like "$1", and the value itself
+// otherwise. A body symbol without a node has an empty label.
+func (ps *parser) resolveLabel(value string, stackContents []int) string {
+	child, ok := parseChildReference(value)
+	if !ok {
+		return value
+	}
+	if node := stackContents[child]; node != noNode {
+		return ps.ast.NodeLabel[node]
+	}
+	return ""
+}
+
+func (ps *parser) resolveAttributes(attributes map[string]string, stackContents []int) map[string]string {
+	resolved := make(map[string]string, len(attributes))
+	for name, value := range attributes {
+		resolved[name] = ps.resolveLabel(value, stackContents)
+	}
+	return resolved
+}
+
+// newLeaf returns the node of a token.
+func (ps *parser) newLeaf(token lexer.Token) int {
+	switch ps.mode {
+	case buildConcreteTree:
+		return ps.cst.addNode(ConcreteNode{token.TokenType, -1, token, token.Start, token.End, nil})
+	case computeValues:
+		return ps.addValue(token)
+	default:
+		var key string
+		if ps.share {
+			key = leafKey(token.TokenType, token.Lexeme)
+		}
+		return ps.numberedNode(key, token.Lexeme, token.Start, token.End, nil, nil)
+	}
+}
+
+func (ps *parser) addValue(value interface{}) int {
+	ps.values = append(ps.values, value)
+	return len(ps.values) - 1
+}
+
+// runAction adds the value of a production, computed from the values of its body by its action. Productions
+// without an action compute their value from their semantic rule.
+func (ps *parser) runAction(p Production, number int, stackContents []int) int {
+	values := make([]interface{}, len(stackContents))
+	for i, node := range stackContents {
+		values[i] = ps.values[node]
 	}
+	if action, ok := ps.actions[number]; ok {
+		return ps.addValue(action(values))
+	}
+	return ps.addValue(ruleValue(p.Rule, values))
+}
+
+// ruleValue returns the value standing for the node a semantic rule would build. A "tree" rule makes a slice of
+// the values of its children, and an "append" rule appends the values of its other children to the slice of its
+// first one. The other rules take the value of their first child, or of the first body symbol if they have no
+// children, and a production with an empty body has a nil value.
+func ruleValue(rule SemanticRule, values []interface{}) interface{} {
+	switch rule.Type {
+	case "tree":
+		list := make([]interface{}, 0, len(rule.Children))
+		for _, child := range rule.Children {
+			list = append(list, values[child])
+		}
+		return list
+	case "append":
+		list, ok := values[rule.Children[0]].([]interface{})
+		if !ok {
+			list = []interface{}{values[rule.Children[0]]}
+		}
+		for _, child := range rule.Children[1:] {
+			list = append(list, values[child])
+		}
+		return list
+	}
+	if len(rule.Children) > 0 {
+		return values[rule.Children[0]]
+	}
+	if len(values) > 0 {
+		return values[0]
+	}
+	return nil
+}
+
+// newNode returns a node of the syntax graph with a label, children and attributes. When subgraphs are shared, a
+// node with the same label, children and attributes is only built once, and keeps the position it was first
+// built at.
+func (ps *parser) newNode(label string, position lexer.Position, end lexer.Position, children []int, attributes map[string]string) int {
+	var key string
+	if ps.share {
+		key = nodeKey(label, children, attributes)
+	}
+	return ps.numberedNode(key, label, position, end, children, attributes)
+}
+
+// numberedNode returns the node numbered by key if there is one, and otherwise builds a node numbered by key. An
+// empty key builds a node which is not shared.
+func (ps *parser) numberedNode(key string, label string, position lexer.Position, end lexer.Position, children []int,
+	attributes map[string]string) int {
+	if key != "" {
+		if node, ok := ps.numbers.nodeOf[key]; ok {
+			ps.numbers.reused[node] = true
+			return node
+		}
+	}
+	node := ps.ast.createNewNode(label, position, end)
+	for _, child := range children {
+		ps.ast.addEdge(node, child)
+	}
+	for name, value := range attributes {
+		ps.ast.setAttribute(node, name, value)
+	}
+	if key != "" {
+		ps.numbers.nodeOf[key] = node
+		ps.numbers.keyOf[node] = key
+	}
+	return node
+}
+
+// appendToNode adds children at the end of a node, which then ends at end. Since the node changes, it is not
+// shared from then on, and a node which is already shared is copied first.
+func (ps *parser) appendToNode(node int, children []int, end lexer.Position) int {
+	if ps.share && !ps.numbers.grown[node] {
+		if ps.numbers.reused[node] {
+			copied := ps.ast.createNewNode(ps.ast.NodeLabel[node], ps.ast.NodePosition[node], end)
+			for _, child := range ps.ast.Graph[node] {
+				ps.ast.addEdge(copied, child)
+			}
+			for name, value := range ps.ast.NodeAttributes[node] {
+				ps.ast.setAttribute(copied, name, value)
+			}
+			node = copied
+		} else {
+			delete(ps.numbers.nodeOf, ps.numbers.keyOf[node])
+		}
+		ps.numbers.grown[node] = true
+	}
+	for _, child := range children {
+		ps.ast.addEdge(node, child)
+	}
+	ps.ast.NodeEnd[node] = end
+	return node
+}
+
+// recover is called on a token for which the current state has no action, and returns whether the parser can go
+// on with the token. Like yacc, the parser pops states until one can shift the error symbol and shifts it, then
+// discards tokens until one can follow it. Without error productions, the parser stops at the first error.
+func (ps *parser) recover(token lexer.Token) bool {
+	tokenType := grammarSymbol(token.TokenType)
+	if ps.recovering == 0 {
+		expected := make(setOfSymbols)
+		for s := range ps.table[ps.pStack.top()] {
+			if s != errorSymbol && ps.g.isTerminal(s) {
+				expected.add(s)
+			}
+		}
+		ps.errs = append(ps.errs, ParseError{token, expected.sorted()})
+	}
+
+	// The error symbol has just been shifted and the token still does not fit, so it is discarded.
+	if ps.recovering == tokensToResync {
+		if tokenType == "$" {
+			ps.dead = true
+		}
+		return false
+	}
+
+	// The stacks are left as they are if no state can shift the error symbol.
+	depth := len(ps.pStack) - 1
+	for ; depth >= 0; depth-- {
+		if action, ok := ps.table[ps.pStack[depth]][errorSymbol]; ok && action.actionType == shift {
+			break
+		}
+	}
+	if depth < 0 {
+		ps.dead = true
+		return false
+	}
+	for len(ps.pStack) > depth+1 {
+		ps.pStack.pop()
+		ps.gStack.pop()
+		ps.ends.popEnd(1, token.Start)
+	}
+	ps.recovering = tokensToResync
+	ps.pStack.push(state(ps.table[ps.pStack.top()][errorSymbol].number))
+	errorToken := lexer.Token{TokenType: string(errorSymbol), Lexeme: string(errorSymbol), Start: token.Start, End: token.Start}
+	ps.gStack.push(ps.newLeaf(errorToken))
+	ps.ends.push(errorToken.End)
+
+	if ps.hasAction(tokenType) {
+		return true
+	}
+	if tokenType == "$" {
+		ps.dead = true
+	}
+	return false
+}
+
+func (ps *parser) hasAction(s grammarSymbol) bool {
+	_, ok := ps.table[ps.pStack.top()][s]
+	return ok
 }
 
 func (ps *parser) parse(tokens []lexer.Token) SyntaxGraph {
@@ -309,4 +805,11 @@ func (ps *parser) reset() {
 	ps.dead = false
 	ps.accepted = false
 	ps.ast = SyntaxGraph{}
+	ps.cst = ConcreteSyntaxTree{}
+	ps.values = nil
+	ps.numbers = newValueNumbers()
+	ps.gStack = graphStack{}
+	ps.ends = nil
+	ps.errs = nil
+	ps.recovering = 0
 }
@@ -3,452 +3,265 @@ package parser
 import (
 	"reflect"
 	"testing"
+
+	"github.com/SaurabhJha/lexpar/lexer"
 )
 
 func TestLrItemNextSymbol(t *testing.T) {
 	var g Grammar
 	g.Productions = []Production{
-		{"expr'", []grammarSymbol{"expr"}, SemanticRule{"", "", []int{}}},
-		{"expr", []grammarSymbol{"expr", "+", "number"}, SemanticRule{"", "", []int{}}},
-		{"expr", []grammarSymbol{"number"}, SemanticRule{"", "", []int{}}},
+		{Head: "expr'", Body: []grammarSymbol{"expr"}, Rule: SemanticRule{Children: []int{}}},
+		{Head: "expr", Body: []grammarSymbol{"expr", "+", "number"}, Rule: SemanticRule{Children: []int{}}},
+		{Head: "expr", Body: []grammarSymbol{"number"}, Rule: SemanticRule{Children: []int{}}},
 	}
 
 	var testData = []struct {
 		item     lrItem
 		expected grammarSymbol
 	}{
-		{lrItem{g, g.Productions[0], 1, nil}, ""},
-		{lrItem{g, g.Productions[1], 1, nil}, "+"},
-		{lrItem{g, g.Productions[2], 0, nil}, "number"},
+		{lrItem{0, 1}, ""},
+		{lrItem{1, 1}, "+"},
+		{lrItem{2, 0}, "number"},
 	}
 
 	for _, test := range testData {
-		if got := test.item.getNextSymbol(); got != test.expected {
+		if got := test.item.getNextSymbol(g); got != test.expected {
 			t.Errorf("Expected next symbol of %v to be %v, got %v", test.item, test.expected, got)
 		}
 	}
 }
 
-func TestLrItemGetNextItem(t *testing.T) {
-	var g Grammar
-	g.Productions = []Production{
-		{"expr'", []grammarSymbol{"expr"}, SemanticRule{"", "", []int{}}},
-		{"expr", []grammarSymbol{"expr", "+", "number"}, SemanticRule{"", "", []int{}}},
-		{"expr", []grammarSymbol{"number"}, SemanticRule{"", "", []int{}}},
-	}
-
+func TestLrItemSetHas(t *testing.T) {
 	var testData = []struct {
-		inputItem   lrItem
-		inputSymbol grammarSymbol
-		expected    lrItem
+		items    []lrItem
+		item     lrItem
+		expected bool
 	}{
-		{lrItem{g, g.Productions[1], 0, nil}, "expr", lrItem{g, g.Productions[1], 1, nil}},
-		{lrItem{g, g.Productions[2], 0, nil}, "number", lrItem{g, g.Productions[2], 1, nil}},
-		{lrItem{g, g.Productions[2], 0, nil}, "expr", lrItem{}},
+		{[]lrItem{{0, 0}, {1, 0}, {2, 0}}, lrItem{1, 0}, true},
+		{[]lrItem{{0, 1}, {1, 0}, {2, 2}}, lrItem{2, 2}, true},
+		{[]lrItem{{0, 1}, {1, 0}, {2, 2}}, lrItem{1, 1}, false},
+		{[]lrItem{}, lrItem{0, 0}, false},
 	}
 
 	for _, test := range testData {
-		if got := test.inputItem.getNextItem(test.inputSymbol); !reflect.DeepEqual(got, test.expected) {
-			t.Errorf("Expected %v.getNextItem = %v, got %v", test.inputItem, test.expected, got)
+		var itemSet lrItemSet
+		for _, item := range test.items {
+			itemSet.add(item, setOfSymbols{"$": true})
+		}
+		if itemSet.has(test.item) != test.expected {
+			t.Errorf("expected %v.has(%v) to be %v", test.items, test.item, test.expected)
 		}
 	}
 }
 
-func TestLrItemEmpty(t *testing.T) {
-	var g Grammar
-	g.Productions = []Production{
-		{"expr'", []grammarSymbol{"expr"}, SemanticRule{"", "", []int{}}},
-		{"expr", []grammarSymbol{"expr", "+", "number"}, SemanticRule{"", "", []int{}}},
-		{"expr", []grammarSymbol{"number"}, SemanticRule{"", "", []int{}}},
-	}
-
+func TestLrItemSetAdd(t *testing.T) {
+	var itemSet lrItemSet
 	var testData = []struct {
-		inputItem lrItem
-		expected  bool
+		item            lrItem
+		lookaheads      setOfSymbols
+		expectedChanged bool
+		expectedItems   []lrItem
 	}{
-		{lrItem{g, g.Productions[2], 1, nil}, false},
-		{lrItem{}, true},
+		{lrItem{0, 0}, setOfSymbols{"$": true}, true, []lrItem{{0, 0}}},
+		{lrItem{1, 0}, setOfSymbols{"+": true}, true, []lrItem{{0, 0}, {1, 0}}},
+		{lrItem{1, 0}, setOfSymbols{"+": true}, false, []lrItem{{0, 0}, {1, 0}}},
+		{lrItem{1, 0}, setOfSymbols{"$": true}, true, []lrItem{{0, 0}, {1, 0}}},
 	}
 
 	for _, test := range testData {
-		if got := test.inputItem.empty(); got != test.expected {
-			t.Errorf("Expected inputItem.empty() to be %v but got %v", test.expected, got)
+		if got := itemSet.add(test.item, test.lookaheads); got != test.expectedChanged {
+			t.Errorf("Expected adding %v with %v to return %v, got %v", test.item, test.lookaheads, test.expectedChanged, got)
 		}
+		if !reflect.DeepEqual(itemSet.items, test.expectedItems) {
+			t.Errorf("Expected items %v, got %v", test.expectedItems, itemSet.items)
+		}
+	}
+	if expected := (setOfSymbols{"+": true, "$": true}); !reflect.DeepEqual(itemSet.lookaheads[lrItem{1, 0}], expected) {
+		t.Errorf("Expected lookaheads %v, got %v", expected, itemSet.lookaheads[lrItem{1, 0}])
 	}
 }
 
-func TestLrItemSetHas(t *testing.T) {
-	var g Grammar
-	g.Productions = []Production{
-		{"expr'", []grammarSymbol{"expr"}, SemanticRule{"", "", []int{}}},
-		{"expr", []grammarSymbol{"expr", "+", "number"}, SemanticRule{"", "", []int{}}},
-		{"expr", []grammarSymbol{"number"}, SemanticRule{"", "", []int{}}},
+func TestLrItemSetKey(t *testing.T) {
+	type itemWithLookaheads struct {
+		item       lrItem
+		lookaheads setOfSymbols
 	}
-
 	var testData = []struct {
-		itemSet  lrItemSet
-		item     lrItem
+		this     []itemWithLookaheads
+		other    []itemWithLookaheads
 		expected bool
 	}{
 		{
-			lrItemSet{
-				[]lrItem{
-					{g, g.Productions[0], 0, nil},
-					{g, g.Productions[1], 0, nil},
-					{g, g.Productions[2], 0, nil},
-				},
-			},
-			lrItem{g, g.Productions[1], 0, nil},
+			[]itemWithLookaheads{{lrItem{0, 0}, setOfSymbols{"$": true}}, {lrItem{2, 0}, setOfSymbols{"+": true}}},
+			[]itemWithLookaheads{{lrItem{0, 0}, setOfSymbols{"$": true}}, {lrItem{2, 0}, setOfSymbols{"+": true}}},
 			true,
 		},
 		{
-			lrItemSet{
-				[]lrItem{
-					{g, g.Productions[0], 1, nil},
-					{g, g.Productions[1], 0, nil},
-					{g, g.Productions[2], 2, nil},
-				},
-			},
-			lrItem{g, g.Productions[2], 2, nil},
-			true,
-		},
-		{
-			lrItemSet{
-				[]lrItem{
-					{g, g.Productions[0], 1, nil},
-					{g, g.Productions[1], 0, nil},
-					{g, g.Productions[2], 2, nil},
-				},
-			},
-			lrItem{g, g.Productions[1], 0, nil},
+			[]itemWithLookaheads{{lrItem{0, 0}, setOfSymbols{"$": true}}, {lrItem{2, 0}, setOfSymbols{"+": true}}},
+			[]itemWithLookaheads{{lrItem{2, 0}, setOfSymbols{"+": true}}, {lrItem{0, 0}, setOfSymbols{"$": true}}},
 			true,
 		},
 		{
-			lrItemSet{
-				[]lrItem{
-					{g, g.Productions[0], 1, nil},
-					{g, g.Productions[1], 0, nil},
-					{g, g.Productions[2], 2, nil},
-				},
-			},
-			lrItem{g, g.Productions[1], 1, nil},
+			[]itemWithLookaheads{{lrItem{0, 0}, setOfSymbols{"$": true}}, {lrItem{2, 0}, setOfSymbols{"+": true}}},
+			[]itemWithLookaheads{{lrItem{0, 0}, setOfSymbols{"$": true}}, {lrItem{1, 0}, setOfSymbols{"+": true}}},
 			false,
 		},
-	}
-
-	for _, test := range testData {
-		if test.itemSet.has(test.item) != test.expected {
-			t.Errorf("expected %v.has(%v) to be %v", test.itemSet, test.item, test.expected)
-		}
-	}
-}
-
-func TestLrItemSetEquals(t *testing.T) {
-	var g Grammar
-	g.Productions = []Production{
-		{"expr'", []grammarSymbol{"expr"}, SemanticRule{"", "", []int{}}},
-		{"expr", []grammarSymbol{"expr", "+", "number"}, SemanticRule{"", "", []int{}}},
-		{"expr", []grammarSymbol{"number"}, SemanticRule{"", "", []int{}}},
-	}
-
-	var testData = []struct {
-		thisItemSet  lrItemSet
-		otherItemSet lrItemSet
-		expected     bool
-	}{
-		{
-			lrItemSet{
-				[]lrItem{
-					{g, g.Productions[0], 0, nil},
-					{g, g.Productions[2], 0, nil},
-				},
-			},
-			lrItemSet{
-				[]lrItem{
-					{g, g.Productions[0], 0, nil},
-					{g, g.Productions[2], 0, nil},
-				},
-			},
-			true,
-		},
 		{
-			lrItemSet{
-				[]lrItem{
-					{g, g.Productions[0], 0, nil},
-					{g, g.Productions[2], 0, nil},
-				},
-			},
-			lrItemSet{
-				[]lrItem{
-					{g, g.Productions[0], 0, nil},
-					{g, g.Productions[1], 0, nil},
-				},
-			},
+			[]itemWithLookaheads{{lrItem{0, 0}, setOfSymbols{"$": true}}, {lrItem{2, 0}, setOfSymbols{"+": true}}},
+			[]itemWithLookaheads{{lrItem{0, 0}, setOfSymbols{"$": true}}, {lrItem{2, 0}, setOfSymbols{"$": true}}},
 			false,
 		},
 		{
-			lrItemSet{
-				[]lrItem{
-					{g, g.Productions[0], 0, nil},
-					{g, g.Productions[1], 0, nil},
-					{g, g.Productions[2], 0, nil},
-				},
-			},
-			lrItemSet{
-				[]lrItem{
-					{g, g.Productions[0], 0, nil},
-					{g, g.Productions[2], 0, nil},
-					{g, g.Productions[1], 0, nil},
-				},
-			},
-			true,
+			[]itemWithLookaheads{{lrItem{0, 0}, setOfSymbols{"$": true}}},
+			[]itemWithLookaheads{{lrItem{0, 0}, setOfSymbols{"$": true}}, {lrItem{2, 0}, setOfSymbols{"+": true}}},
+			false,
 		},
 	}
 
 	for _, test := range testData {
-		if got := test.thisItemSet.equals(&test.otherItemSet); got != test.expected {
-			t.Errorf("Expected equals to be %v, but got %v", test.expected, got)
+		var this, other lrItemSet
+		for _, i := range test.this {
+			this.add(i.item, i.lookaheads)
+		}
+		for _, i := range test.other {
+			other.add(i.item, i.lookaheads)
+		}
+		if got := this.key() == other.key(); got != test.expected {
+			t.Errorf("Expected keys of %v and %v to be equal to be %v, but got %v", test.this, test.other, test.expected, got)
 		}
 	}
 }
 
-func TestLrItemSetAdd(t *testing.T) {
+func TestComputeLrItemSetNextSymbols(t *testing.T) {
 	var g Grammar
 	g.Productions = []Production{
-		{"expr'", []grammarSymbol{"expr"}, SemanticRule{"", "", []int{}}},
-		{"expr", []grammarSymbol{"expr", "+", "number"}, SemanticRule{"", "", []int{}}},
-		{"expr", []grammarSymbol{"number"}, SemanticRule{"", "", []int{}}},
+		{Head: "expr'", Body: []grammarSymbol{"expr"}, Rule: SemanticRule{Children: []int{}}},
+		{Head: "expr", Body: []grammarSymbol{"expr", "+", "number"}, Rule: SemanticRule{Children: []int{}}},
+		{Head: "expr", Body: []grammarSymbol{"number"}, Rule: SemanticRule{Children: []int{}}},
 	}
 
 	var testData = []struct {
-		itemSet  lrItemSet
-		item     lrItem
-		expected lrItemSet
+		items    []lrItem
+		expected setOfSymbols
 	}{
-		{
-			lrItemSet{
-				[]lrItem{
-					{g, g.Productions[0], 0, nil},
-					{g, g.Productions[2], 0, nil},
-				},
-			},
-			lrItem{g, g.Productions[1], 0, nil},
-			lrItemSet{
-				[]lrItem{
-					{g, g.Productions[0], 0, nil},
-					{g, g.Productions[2], 0, nil},
-					{g, g.Productions[1], 0, nil},
-				},
-			},
-		},
-		{
-			lrItemSet{
-				[]lrItem{
-					{g, g.Productions[0], 0, nil},
-					{g, g.Productions[1], 0, nil},
-					{g, g.Productions[2], 0, nil},
-				},
-			},
-			lrItem{g, g.Productions[1], 0, nil},
-			lrItemSet{
-				[]lrItem{
-					{g, g.Productions[0], 0, nil},
-					{g, g.Productions[2], 0, nil},
-					{g, g.Productions[1], 0, nil},
-				},
-			},
-		},
+		{[]lrItem{{0, 1}, {2, 1}}, setOfSymbols{}},
+		{[]lrItem{{0, 0}, {1, 0}, {2, 0}}, setOfSymbols{"expr": true, "number": true}},
 	}
 
 	for _, test := range testData {
-		if test.itemSet.add(test.item); !test.itemSet.equals(&test.expected) {
-			t.Errorf("Expected adding %v to result in %v, got %v", test.item, test.itemSet, test.expected)
+		var itemSet lrItemSet
+		for _, item := range test.items {
+			itemSet.add(item, nil)
+		}
+		if got := itemSet.getNextSymbols(g); !reflect.DeepEqual(got, test.expected) {
+			t.Errorf("Expected symbols out of item set %v to be %v, got %v", test.items, test.expected, got)
 		}
 	}
 }
 
-func TestComputeLrItemSetNextSymbols(t *testing.T) {
+func TestComputeLrItemClosureSet(t *testing.T) {
 	var g Grammar
+	g.Start = "S'"
 	g.Productions = []Production{
-		{"expr'", []grammarSymbol{"expr"}, SemanticRule{"", "", []int{}}},
-		{"expr", []grammarSymbol{"expr", "+", "number"}, SemanticRule{"", "", []int{}}},
-		{"expr", []grammarSymbol{"number"}, SemanticRule{"", "", []int{}}},
+		{Head: "S'", Body: []grammarSymbol{"S"}},
+		{Head: "S", Body: []grammarSymbol{"C", "C"}},
+		{Head: "C", Body: []grammarSymbol{"c", "C"}},
+		{Head: "C", Body: []grammarSymbol{"d"}},
 	}
+	gi := g.index()
 
 	var testData = []struct {
-		itemSet  lrItemSet
-		expected setOfSymbols
+		input      lrItem
+		lookaheads setOfSymbols
+		expected   map[lrItem]setOfSymbols
 	}{
 		{
-			lrItemSet{
-				[]lrItem{
-					{g, g.Productions[0], 1, nil},
-					{g, g.Productions[2], 1, nil},
-				},
+			lrItem{0, 0},
+			setOfSymbols{"$": true},
+			map[lrItem]setOfSymbols{
+				{0, 0}: {"$": true},
+				{1, 0}: {"$": true},
+				{2, 0}: {"c": true, "d": true},
+				{3, 0}: {"c": true, "d": true},
 			},
-			setOfSymbols{},
 		},
 		{
-			lrItemSet{
-				[]lrItem{
-					{g, g.Productions[0], 0, nil},
-					{g, g.Productions[1], 0, nil},
-					{g, g.Productions[2], 0, nil},
-				},
+			lrItem{3, 1},
+			setOfSymbols{"c": true, "d": true},
+			map[lrItem]setOfSymbols{
+				{3, 1}: {"c": true, "d": true},
 			},
-			setOfSymbols{"expr": true, "number": true},
 		},
-	}
-
-	for _, test := range testData {
-		if got := test.itemSet.getNextSymbols(); !reflect.DeepEqual(got, test.expected) {
-			t.Errorf("Expected symbols out of item set %v to be %v, got %v", test.itemSet, test.expected, got)
-		}
-	}
-}
-
-func TestComputeLrItemSetMergeWith(t *testing.T) {
-	var g Grammar
-	g.Productions = []Production{
-		{"expr'", []grammarSymbol{"expr"}, SemanticRule{"", "", []int{}}},
-		{"expr", []grammarSymbol{"expr", "+", "number"}, SemanticRule{"", "", []int{}}},
-		{"expr", []grammarSymbol{"number"}, SemanticRule{"", "", []int{}}},
-	}
-
-	var testData = []struct {
-		itemSet      lrItemSet
-		otherItemSet lrItemSet
-		expected     lrItemSet
-	}{
 		{
-			lrItemSet{
-				[]lrItem{
-					{g, g.Productions[0], 1, nil},
-					{g, g.Productions[2], 1, nil},
-				},
-			},
-			lrItemSet{
-				[]lrItem{
-					{g, g.Productions[0], 0, nil},
-					{g, g.Productions[2], 1, nil},
-				},
-			},
-			lrItemSet{
-				[]lrItem{
-					{g, g.Productions[0], 0, nil},
-					{g, g.Productions[0], 1, nil},
-					{g, g.Productions[2], 1, nil},
-				},
+			lrItem{1, 1},
+			setOfSymbols{"$": true},
+			map[lrItem]setOfSymbols{
+				{1, 1}: {"$": true},
+				{2, 0}: {"$": true},
+				{3, 0}: {"$": true},
 			},
 		},
 	}
 
 	for _, test := range testData {
-		if test.itemSet.mergeWith(&test.otherItemSet); !test.itemSet.equals(&test.expected) {
-			t.Errorf("Expected %v to equal %v", test.itemSet, test.expected)
+		var kernel lrItemSet
+		kernel.add(test.input, test.lookaheads)
+		if got := gi.computeClosureSet(kernel); !reflect.DeepEqual(got.lookaheads, test.expected) {
+			t.Errorf("Expected closure of %v to be %v, got %v", test.input, test.expected, got.lookaheads)
 		}
 	}
 }
 
-func TestComputeLrItemClosureSet(t *testing.T) {
+func TestComputeLrItemSetNextKernel(t *testing.T) {
 	var g Grammar
-	g.Start = "S'"
 	g.Productions = []Production{
-		{"S'", []grammarSymbol{"S"}, SemanticRule{}},
-		{"S", []grammarSymbol{"C", "C"}, SemanticRule{}},
-		{"C", []grammarSymbol{"c", "C"}, SemanticRule{}},
-		{"C", []grammarSymbol{"d"}, SemanticRule{}},
+		{Head: "expr'", Body: []grammarSymbol{"expr"}, Rule: SemanticRule{Children: []int{}}},
+		{Head: "expr", Body: []grammarSymbol{"expr", "+", "number"}, Rule: SemanticRule{Children: []int{}}},
+		{Head: "expr", Body: []grammarSymbol{"number"}, Rule: SemanticRule{Children: []int{}}},
 	}
 
-	// The production order is jumbled up in some tests to test equality.
 	var testData = []struct {
-		input    lrItem
-		expected lrItemSet
+		items    []lrItem
+		symbol   grammarSymbol
+		expected []lrItem
 	}{
-		{
-			lrItem{g, g.Productions[0], 0, map[grammarSymbol]bool{"$": true}},
-			lrItemSet{
-				itemSet: []lrItem{
-					{g, g.Productions[0], 0, map[grammarSymbol]bool{"$": true}},
-					{g, g.Productions[1], 0, map[grammarSymbol]bool{"$": true}},
-					{g, g.Productions[2], 0, map[grammarSymbol]bool{"c": true, "d": true}},
-					{g, g.Productions[3], 0, map[grammarSymbol]bool{"c": true, "d": true}},
-				},
-			},
-		},
-		{
-			lrItem{g, g.Productions[3], 1, map[grammarSymbol]bool{"c": true, "d": true}},
-			lrItemSet{
-				itemSet: []lrItem{
-					{g, g.Productions[3], 1, map[grammarSymbol]bool{"c": true, "d": true}},
-				},
-			},
-		},
-		{
-			lrItem{g, g.Productions[1], 1, map[grammarSymbol]bool{"c": true, "d": true}},
-			lrItemSet{
-				itemSet: []lrItem{
-					{g, g.Productions[1], 1, map[grammarSymbol]bool{"c": true, "d": true}},
-					{g, g.Productions[2], 0, map[grammarSymbol]bool{"c": true, "d": true}},
-					{g, g.Productions[3], 0, map[grammarSymbol]bool{"c": true, "d": true}},
-				},
-			},
-		},
+		{[]lrItem{{0, 0}, {1, 0}, {2, 0}}, "expr", []lrItem{{0, 1}, {1, 1}}},
+		{[]lrItem{{0, 0}, {1, 0}, {2, 0}}, "number", []lrItem{{2, 1}}},
+		{[]lrItem{{1, 1}}, "expr", nil},
 	}
 
 	for _, test := range testData {
-		if got := test.input.computeClosureSet(); !got.equals(&test.expected) {
-			t.Errorf("Expected computeClosureSet() = %v, got %v", test.expected, got)
+		var itemSet lrItemSet
+		for _, item := range test.items {
+			itemSet.add(item, setOfSymbols{"$": true})
+		}
+		if got := itemSet.getNextKernel(g, test.symbol); !reflect.DeepEqual(got.items, test.expected) {
+			t.Errorf("Expected %v.getNextKernel(%v) to be %v, got %v", test.items, test.symbol, test.expected, got.items)
 		}
 	}
 }
 
-func TestComputeLrItemSetNext(t *testing.T) {
-	var g Grammar
-	g.Productions = []Production{
-		{"expr'", []grammarSymbol{"expr"}, SemanticRule{"", "", []int{}}},
-		{"expr", []grammarSymbol{"expr", "+", "number"}, SemanticRule{"", "", []int{}}},
-		{"expr", []grammarSymbol{"number"}, SemanticRule{"", "", []int{}}},
-	}
+func TestSeenLrItemSets(t *testing.T) {
+	var first, second, same lrItemSet
+	first.add(lrItem{0, 1}, setOfSymbols{"$": true})
+	second.add(lrItem{0, 1}, setOfSymbols{"+": true})
+	same.add(lrItem{0, 1}, setOfSymbols{"$": true})
 
+	var seen seenLrItemSets
 	var testData = []struct {
-		itemSet  lrItemSet
-		symbol   grammarSymbol
-		expected lrItemSet
+		kernel        lrItemSet
+		expectedState state
+		expectedNew   bool
 	}{
-		{
-			lrItemSet{
-				[]lrItem{
-					{g, g.Productions[0], 0, nil},
-					{g, g.Productions[1], 0, nil},
-					{g, g.Productions[2], 0, nil},
-				},
-			},
-			"expr",
-			lrItemSet{
-				[]lrItem{
-					{g, g.Productions[0], 1, nil},
-					{g, g.Productions[1], 1, nil},
-				},
-			},
-		},
-		{
-			lrItemSet{
-				[]lrItem{
-					{g, g.Productions[1], 1, nil},
-				},
-			},
-			"expr",
-			lrItemSet{
-				[]lrItem{},
-			},
-		},
+		{first, 0, true},
+		{second, 1, true},
+		{same, 0, false},
 	}
 
 	for _, test := range testData {
-		if got := test.itemSet.getNextItemSet(test.symbol); !got.equals(&test.expected) {
-			t.Errorf(
-				"Expected %v.nextItemSet(%v) to be %v, got %v", test.itemSet, test.symbol, test.expected, got)
+		if got, isNew := seen.getStateNumber(test.kernel); got != test.expectedState || isNew != test.expectedNew {
+			t.Errorf("Expected state number of %v to be %v %v, got %v %v",
+				test.kernel.items, test.expectedState, test.expectedNew, got, isNew)
 		}
 	}
 }
@@ -487,3 +300,160 @@ func TestParsingTableAddAccept(t *testing.T) {
 		t.Errorf("On %v and %v, expected %v, got %v", 3, "$", parserAction{accept, 0}, got)
 	}
 }
+
+func TestParserNodePositions(t *testing.T) {
+	var g Grammar
+	g.Start = "expr'"
+	g.Productions = []Production{
+		{Head: "expr'", Body: []grammarSymbol{"expr"}, Rule: SemanticRule{}},
+		{Head: "expr", Body: []grammarSymbol{"expr", "+", "number"}, Rule: SemanticRule{Type: "tree", RootLabel: "+", Children: []int{0, 2}}},
+		{Head: "expr", Body: []grammarSymbol{"number"}, Rule: SemanticRule{}},
+	}
+
+	tokens := []lexer.Token{
+		{TokenType: "number", Lexeme: "12", Start: lexer.Position{Offset: 1, Line: 1, Column: 2}, End: lexer.Position{Offset: 3, Line: 1, Column: 4}},
+		{TokenType: "+", Lexeme: "+", Start: lexer.Position{Offset: 4, Line: 1, Column: 5}, End: lexer.Position{Offset: 5, Line: 1, Column: 6}},
+		{TokenType: "number", Lexeme: "8", Start: lexer.Position{Offset: 7, Line: 2, Column: 1}, End: lexer.Position{Offset: 8, Line: 2, Column: 2}},
+		{TokenType: "$", Lexeme: "$"},
+	}
+	ps, _ := g.compile()
+	ast := ps.parse(tokens)
+
+	expected := []lexer.Position{
+		{Offset: 1, Line: 1, Column: 2},
+		{Offset: 4, Line: 1, Column: 5},
+		{Offset: 7, Line: 2, Column: 1},
+		{Offset: 1, Line: 1, Column: 2},
+	}
+	if !reflect.DeepEqual(ast.NodePosition, expected) {
+		t.Errorf("Expected node positions %v, got %v", expected, ast.NodePosition)
+	}
+	expectedEnds := []lexer.Position{
+		{Offset: 3, Line: 1, Column: 4},
+		{Offset: 5, Line: 1, Column: 6},
+		{Offset: 8, Line: 2, Column: 2},
+		{Offset: 8, Line: 2, Column: 2},
+	}
+	if !reflect.DeepEqual(ast.NodeEnd, expectedEnds) {
+		t.Errorf("Expected node ends %v, got %v", expectedEnds, ast.NodeEnd)
+	}
+}
+
+func TestLrAutomatonMergeCores(t *testing.T) {
+	var testData = []struct {
+		productions       []Production
+		expectedLr1States int
+		expectedStates    int
+		expectedConflicts []Conflict
+	}{
+		{
+			[]Production{
+				{Head: "S'", Body: []grammarSymbol{"S"}},
+				{Head: "S", Body: []grammarSymbol{"C", "C"}},
+				{Head: "C", Body: []grammarSymbol{"c", "C"}},
+				{Head: "C", Body: []grammarSymbol{"d"}},
+			},
+			10,
+			7,
+			[]Conflict{},
+		},
+		{
+			// An LR(1) grammar which is not LALR(1).
+			[]Production{
+				{Head: "S'", Body: []grammarSymbol{"S"}},
+				{Head: "S", Body: []grammarSymbol{"a", "A", "d"}},
+				{Head: "S", Body: []grammarSymbol{"b", "B", "d"}},
+				{Head: "S", Body: []grammarSymbol{"a", "B", "e"}},
+				{Head: "S", Body: []grammarSymbol{"b", "A", "e"}},
+				{Head: "A", Body: []grammarSymbol{"c"}},
+				{Head: "B", Body: []grammarSymbol{"c"}},
+			},
+			14,
+			13,
+			[]Conflict{
+				{ReduceReduce, 6, "d", []int{5, 6}, []string{"A -> c .", "B -> c ."}, true},
+				{ReduceReduce, 6, "e", []int{5, 6}, []string{"A -> c .", "B -> c ."}, true},
+			},
+		},
+	}
+
+	for _, test := range testData {
+		g := Grammar{Productions: test.productions, Start: "S'"}
+		gi := g.index()
+		automaton := gi.computeCanonicalCollection(0)
+		if got := len(automaton.itemSets); got != test.expectedLr1States {
+			t.Errorf("Expected %v LR(1) states, got %v", test.expectedLr1States, got)
+		}
+		merged, conflicts := automaton.mergeCores(g)
+		if got := len(merged.itemSets); got != test.expectedStates {
+			t.Errorf("Expected %v LALR(1) states, got %v", test.expectedStates, got)
+		}
+		if !reflect.DeepEqual(conflicts, test.expectedConflicts) {
+			t.Errorf("Expected merge conflicts %v, got %v", test.expectedConflicts, conflicts)
+		}
+	}
+}
+
+func TestLrItemFormat(t *testing.T) {
+	var g Grammar
+	g.Productions = []Production{
+		{Head: "expr", Body: []grammarSymbol{"expr", "+", "number"}},
+		{Head: "expr", Body: []grammarSymbol{}},
+	}
+
+	var testData = []struct {
+		item     lrItem
+		expected string
+	}{
+		{lrItem{0, 0}, "expr -> . expr + number"},
+		{lrItem{0, 2}, "expr -> expr + . number"},
+		{lrItem{0, 3}, "expr -> expr + number ."},
+		{lrItem{1, 0}, "expr -> ."},
+	}
+
+	for _, test := range testData {
+		if got := test.item.format(g); got != test.expected {
+			t.Errorf("Expected %v.format() = %q, got %q", test.item, test.expected, got)
+		}
+	}
+}
+
+func TestComputeLrItemClosureSetNullable(t *testing.T) {
+	gi := nullableGrammar.index()
+
+	var testData = []struct {
+		input      lrItem
+		lookaheads setOfSymbols
+		expected   map[lrItem]setOfSymbols
+	}{
+		{
+			lrItem{1, 2},
+			setOfSymbols{"$": true},
+			map[lrItem]setOfSymbols{
+				{1, 2}: {"$": true},
+				{2, 0}: {")": true},
+				{3, 0}: {")": true},
+				{4, 0}: {")": true, ",": true},
+				{5, 0}: {")": true, ",": true},
+			},
+		},
+		{
+			lrItem{1, 4},
+			setOfSymbols{"$": true},
+			map[lrItem]setOfSymbols{
+				{1, 4}: {"$": true},
+				{6, 0}: {"$": true},
+				{7, 0}: {"?": true, "$": true},
+				{8, 0}: {"?": true, "$": true},
+			},
+		},
+	}
+
+	for _, test := range testData {
+		var kernel lrItemSet
+		kernel.add(test.input, test.lookaheads)
+		if got := gi.computeClosureSet(kernel); !reflect.DeepEqual(got.lookaheads, test.expected) {
+			t.Errorf("Expected closure of %v to be %v, got %v", test.input, test.expected, got.lookaheads)
+		}
+	}
+}
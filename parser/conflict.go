@@ -0,0 +1,57 @@
+package parser
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ConflictKind tells which actions of the parsing table are in conflict.
+type ConflictKind string
+
+const (
+	// ShiftReduce is a conflict between shifting the lookahead and reducing by a production.
+	ShiftReduce ConflictKind = "shift-reduce"
+	// ReduceReduce is a conflict between reducing by different productions.
+	ReduceReduce ConflictKind = "reduce-reduce"
+)
+
+// Conflict is an entry of the parsing table for which the grammar allows more than one action. Reducing by the
+// production of the start symbol on "$" is the accept action.
+type Conflict struct {
+	Kind   ConflictKind
+	State  int
+	Symbol grammarSymbol
+	// Productions are the numbers of the productions that can be reduced on Symbol.
+	Productions []int
+	// Items are the items of the state asking for the conflicting actions, written like "expr -> expr . + term".
+	Items []string
+	// IntroducedByMerge is set for conflicts of an LALR(1) table that are not in the canonical LR(1) table.
+	IntroducedByMerge bool
+}
+
+func (c Conflict) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%v conflict on state %v and input %v", c.Kind, c.State, c.Symbol)
+	if c.IntroducedByMerge {
+		b.WriteString(" introduced by LALR(1) merging")
+	}
+	for _, item := range c.Items {
+		b.WriteString("\n\t")
+		b.WriteString(item)
+	}
+	return b.String()
+}
+
+// ConflictError lists every conflict found while building a parsing table.
+type ConflictError struct {
+	Conflicts []Conflict
+}
+
+func (e *ConflictError) Error() string {
+	report := make([]string, 0, len(e.Conflicts)+1)
+	report = append(report, fmt.Sprintf("grammar has %v conflicts", len(e.Conflicts)))
+	for _, c := range e.Conflicts {
+		report = append(report, c.String())
+	}
+	return strings.Join(report, "\n")
+}
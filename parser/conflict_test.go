@@ -0,0 +1,20 @@
+package parser
+
+import "testing"
+
+func TestConflictErrorMessage(t *testing.T) {
+	err := &ConflictError{[]Conflict{
+		{ShiftReduce, 6, "+", []int{1}, []string{"expr -> expr + expr .", "expr -> expr . + expr"}, false},
+		{ReduceReduce, 4, "d", []int{5, 6}, []string{"A -> c .", "B -> c ."}, true},
+	}}
+	expected := "grammar has 2 conflicts\n" +
+		"shift-reduce conflict on state 6 and input +\n" +
+		"\texpr -> expr + expr .\n" +
+		"\texpr -> expr . + expr\n" +
+		"reduce-reduce conflict on state 4 and input d introduced by LALR(1) merging\n" +
+		"\tA -> c .\n" +
+		"\tB -> c ."
+	if got := err.Error(); got != expected {
+		t.Errorf("Expected error message %q, got %q", expected, got)
+	}
+}
@@ -1,7 +1,11 @@
 package parser
 
 import (
-	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/SaurabhJha/lexpar/lexer"
 )
 
 type setOfSymbols map[grammarSymbol]bool
@@ -20,13 +24,13 @@ func (ss *setOfSymbols) has(s grammarSymbol) bool {
 	return (*ss)[s]
 }
 
-func (ss *setOfSymbols) hasSubset(os *setOfSymbols) bool {
-	for s := range *os {
-		if !(*ss).has(s) {
-			return false
-		}
+func (ss setOfSymbols) sorted() []grammarSymbol {
+	symbols := make([]grammarSymbol, 0, len(ss))
+	for s := range ss {
+		symbols = append(symbols, s)
 	}
-	return true
+	sort.Slice(symbols, func(i, j int) bool { return symbols[i] < symbols[j] })
+	return symbols
 }
 
 type queueOfItems []lrItem
@@ -45,45 +49,26 @@ func (q *queueOfItems) empty() bool {
 	return len(*q) == 0
 }
 
-type queueOfItemSets []lrItemSet
-
-func (q *queueOfItemSets) enqueue(ls lrItemSet) {
-	*q = append(*q, ls)
-}
-
-func (q *queueOfItemSets) dequeue() lrItemSet {
-	front := (*q)[0]
-	(*q) = (*q)[1:]
-	return front
-}
-
-func (q *queueOfItemSets) empty() bool {
-	return len(*q) == 0
+// seenLrItemSets numbers the item sets found while building the parsing table. Item sets are identified by their
+// kernel, since the closure of a kernel is always the same, and looked up by the key of the kernel.
+type seenLrItemSets struct {
+	kernels []lrItemSet
+	numbers map[string]state
 }
 
-type seenLrItemSets []lrItemSet
-
-func (lss *seenLrItemSets) add(ls lrItemSet) {
-	*lss = append(*lss, ls)
-}
-
-func (lss *seenLrItemSets) has(ls lrItemSet) bool {
-	for _, sls := range *lss {
-		if reflect.DeepEqual(sls, ls) {
-			return true
-		}
+// getStateNumber returns the number of the item set with the given kernel, numbering it first if it has not been
+// seen before. The second return value tells whether the item set was new.
+func (lss *seenLrItemSets) getStateNumber(kernel lrItemSet) (state, bool) {
+	if lss.numbers == nil {
+		lss.numbers = make(map[string]state)
 	}
-	return false
-}
-
-func (lss *seenLrItemSets) getStateNumber(ls lrItemSet) state {
-	for i, sls := range *lss {
-		if reflect.DeepEqual(sls, ls) {
-			return state(i)
-		}
+	key := kernel.key()
+	if number, ok := lss.numbers[key]; ok {
+		return number, false
 	}
-	lss.add(ls)
-	return state(len(*lss) - 1)
+	lss.numbers[key] = state(len(lss.kernels))
+	lss.kernels = append(lss.kernels, kernel)
+	return state(len(lss.kernels) - 1), true
 }
 
 type parserStack []state
@@ -107,18 +92,35 @@ func (ss *parserStack) empty() bool {
 }
 
 // SyntaxGraph is a data structure representation of a program text. It is produced by
-// Parser.
+// Parser. NodePosition holds the position in the program text where each node starts, NodeEnd the position where
+// the last token of the text it was parsed from ends, and NodeAttributes the attributes attached to nodes by
+// semantic rules.
 type SyntaxGraph struct {
-	Graph     map[int][]int
-	NodeLabel []string
-	Root      int
+	Graph          map[int][]int
+	NodeLabel      []string
+	NodePosition   []lexer.Position
+	NodeEnd        []lexer.Position
+	NodeAttributes map[int]map[string]string
+	Root           int
 }
 
-func (ast *SyntaxGraph) createNewNode(lexeme string) int {
+func (ast *SyntaxGraph) createNewNode(lexeme string, position lexer.Position, end lexer.Position) int {
 	ast.NodeLabel = append(ast.NodeLabel, lexeme)
+	ast.NodePosition = append(ast.NodePosition, position)
+	ast.NodeEnd = append(ast.NodeEnd, end)
 	return len(ast.NodeLabel) - 1
 }
 
+func (ast *SyntaxGraph) setAttribute(node int, name string, value string) {
+	if ast.NodeAttributes == nil {
+		ast.NodeAttributes = make(map[int]map[string]string)
+	}
+	if ast.NodeAttributes[node] == nil {
+		ast.NodeAttributes[node] = make(map[string]string)
+	}
+	ast.NodeAttributes[node][name] = value
+}
+
 func (ast *SyntaxGraph) addEdge(start int, end int) {
 	if ast.Graph == nil {
 		ast.Graph = make(map[int][]int)
@@ -126,6 +128,81 @@ func (ast *SyntaxGraph) addEdge(start int, end int) {
 	ast.Graph[start] = append(ast.Graph[start], end)
 }
 
+// valueNumbers numbers the nodes of a syntax graph by their label and children, so that equal subgraphs can be
+// shared. keyOf holds the key each node is numbered by, reused the nodes which have been handed out more than
+// once, and grown the nodes which have been changed after being built and are no longer numbered.
+type valueNumbers struct {
+	nodeOf map[string]int
+	keyOf  map[int]string
+	reused map[int]bool
+	grown  map[int]bool
+}
+
+func newValueNumbers() valueNumbers {
+	return valueNumbers{make(map[string]int), make(map[int]string), make(map[int]bool), make(map[int]bool)}
+}
+
+// leafKey is the key of the leaf of a token. It holds the token type, so that tokens of different types with the
+// same lexeme are different leaves, and it never equals the key of a node built by a rule.
+func leafKey(tokenType string, lexeme string) string {
+	return "token " + strconv.Quote(tokenType) + " " + strconv.Quote(lexeme)
+}
+
+func nodeKey(label string, children []int, attributes map[string]string) string {
+	var b strings.Builder
+	b.WriteString(strconv.Quote(label))
+	for _, child := range children {
+		b.WriteByte(' ')
+		b.WriteString(strconv.Itoa(child))
+	}
+	for _, name := range sortedKeys(attributes) {
+		b.WriteByte(' ')
+		b.WriteString(strconv.Quote(name))
+		b.WriteByte('=')
+		b.WriteString(strconv.Quote(attributes[name]))
+	}
+	return b.String()
+}
+
+// ConcreteNode is a node of a ConcreteSyntaxTree. It stands either for a production, whose number is Production
+// and whose head is Symbol, with a child per symbol of its body, or for a token, with Production set to -1 and
+// Symbol to the token type. Start and End are the positions of the program text the node spans.
+type ConcreteNode struct {
+	Symbol     string
+	Production int
+	Token      lexer.Token
+	Start      lexer.Position
+	End        lexer.Position
+	Children   []int
+}
+
+// ConcreteSyntaxTree is the parse tree of a program text, built by Parser.ParseConcrete without looking at the
+// semantic rules of the grammar.
+type ConcreteSyntaxTree struct {
+	Nodes []ConcreteNode
+	Root  int
+}
+
+func (cst *ConcreteSyntaxTree) addNode(node ConcreteNode) int {
+	cst.Nodes = append(cst.Nodes, node)
+	return len(cst.Nodes) - 1
+}
+
+// addProductionNode adds the node of a production over the nodes of its body. A production with an empty body
+// spans no text, at the position where the next token starts.
+func (cst *ConcreteSyntaxTree) addProductionNode(p Production, number int, children []int, next lexer.Position) int {
+	node := ConcreteNode{string(p.Head), number, lexer.Token{}, next, next, children}
+	if len(children) > 0 {
+		node.Start = cst.Nodes[children[0]].Start
+		node.End = cst.Nodes[children[len(children)-1]].End
+	}
+	return cst.addNode(node)
+}
+
+// noNode stands on the graph stack for a grammar symbol without a node in the syntax graph, like an empty
+// production without a rule.
+const noNode = -1
+
 type graphStack []int
 
 func (gs *graphStack) push(n int) {
@@ -141,3 +218,20 @@ func (gs *graphStack) pop() int {
 func (gs *graphStack) top() int {
 	return (*gs)[len(*gs)-1]
 }
+
+// endStack holds where the text of each symbol on the parser stack ends.
+type endStack []lexer.Position
+
+func (es *endStack) push(end lexer.Position) {
+	(*es) = append(*es, end)
+}
+
+// popEnd pops the ends of the last n symbols and returns where the last of them ends, or next if n is 0.
+func (es *endStack) popEnd(n int, next lexer.Position) lexer.Position {
+	if n == 0 {
+		return next
+	}
+	end := (*es)[len(*es)-1]
+	*es = (*es)[:len(*es)-n]
+	return end
+}
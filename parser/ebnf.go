@@ -0,0 +1,276 @@
+package parser
+
+import (
+	"fmt"
+	"strings"
+)
+
+type ebnfKind int
+
+const (
+	ebnfSymbol ebnfKind = iota
+	ebnfSequence
+	ebnfAlternation
+	ebnfStar
+	ebnfPlus
+	ebnfOptional
+)
+
+// ebnfNode is a node of a parsed EBNF body. Symbols are leaves, and the other kinds of nodes have children.
+type ebnfNode struct {
+	kind     ebnfKind
+	symbol   grammarSymbol
+	children []ebnfNode
+}
+
+// ebnfOperators are the characters with a meaning in EBNF bodies. Symbols having them need to be quoted.
+const ebnfOperators = "()|*+?"
+
+const ebnfSpaces = " \t\r\n"
+
+// scanEbnf splits an EBNF body into operators and symbols. Quoted symbols keep their quotes so that they can be
+// told apart from operators.
+func scanEbnf(body string) ([]string, error) {
+	tokens := make([]string, 0)
+	for i := 0; i < len(body); {
+		switch c := body[i]; {
+		case strings.IndexByte(ebnfSpaces, c) >= 0:
+			i++
+		case strings.IndexByte(ebnfOperators, c) >= 0:
+			tokens = append(tokens, body[i:i+1])
+			i++
+		case c == '\'':
+			length := strings.IndexByte(body[i+1:], '\'')
+			if length < 0 {
+				return nil, fmt.Errorf("unterminated quoted symbol at %v", i)
+			}
+			if length == 0 {
+				return nil, fmt.Errorf("empty quoted symbol at %v", i)
+			}
+			tokens = append(tokens, body[i:i+length+2])
+			i += length + 2
+		default:
+			j := i
+			for j < len(body) && strings.IndexByte(ebnfSpaces+ebnfOperators, body[j]) < 0 {
+				j++
+			}
+			tokens = append(tokens, body[i:j])
+			i = j
+		}
+	}
+	return tokens, nil
+}
+
+// ebnfParser is a recursive descent parser for EBNF bodies.
+type ebnfParser struct {
+	tokens []string
+	pos    int
+}
+
+func parseEbnf(body string) (ebnfNode, error) {
+	tokens, err := scanEbnf(body)
+	if err != nil {
+		return ebnfNode{}, err
+	}
+	ep := ebnfParser{tokens, 0}
+	node, err := ep.parseAlternation()
+	if err != nil {
+		return ebnfNode{}, err
+	}
+	if ep.peek() != "" {
+		return ebnfNode{}, fmt.Errorf("unexpected %v", ep.peek())
+	}
+	return node, nil
+}
+
+func (ep *ebnfParser) peek() string {
+	if ep.pos == len(ep.tokens) {
+		return ""
+	}
+	return ep.tokens[ep.pos]
+}
+
+func (ep *ebnfParser) parseAlternation() (ebnfNode, error) {
+	alternatives := make([]ebnfNode, 0, 1)
+	for {
+		sequence, err := ep.parseSequence()
+		if err != nil {
+			return ebnfNode{}, err
+		}
+		alternatives = append(alternatives, sequence)
+		if ep.peek() != "|" {
+			break
+		}
+		ep.pos++
+	}
+	if len(alternatives) == 1 {
+		return alternatives[0], nil
+	}
+	return ebnfNode{kind: ebnfAlternation, children: alternatives}, nil
+}
+
+// parseSequence parses the items up to the end of the enclosing group or alternative. An empty sequence stands for
+// the empty string.
+func (ep *ebnfParser) parseSequence() (ebnfNode, error) {
+	items := make([]ebnfNode, 0)
+	for next := ep.peek(); next != "" && next != "|" && next != ")"; next = ep.peek() {
+		item, err := ep.parseItem()
+		if err != nil {
+			return ebnfNode{}, err
+		}
+		items = append(items, item)
+	}
+	if len(items) == 1 {
+		return items[0], nil
+	}
+	return ebnfNode{kind: ebnfSequence, children: items}, nil
+}
+
+func (ep *ebnfParser) parseItem() (ebnfNode, error) {
+	var item ebnfNode
+	switch next := ep.peek(); next {
+	case "(":
+		ep.pos++
+		group, err := ep.parseAlternation()
+		if err != nil {
+			return ebnfNode{}, err
+		}
+		if ep.peek() != ")" {
+			return ebnfNode{}, fmt.Errorf("missing )")
+		}
+		ep.pos++
+		item = group
+	case "*", "+", "?":
+		return ebnfNode{}, fmt.Errorf("%v has nothing to repeat", next)
+	default:
+		// Only quoted symbols lose their quotes, so that bare symbols like expr' keep their last character.
+		ep.pos++
+		if strings.HasPrefix(next, "'") {
+			next = next[1 : len(next)-1]
+		}
+		item = ebnfNode{kind: ebnfSymbol, symbol: grammarSymbol(next)}
+	}
+
+	for {
+		switch ep.peek() {
+		case "*":
+			item = ebnfNode{kind: ebnfStar, children: []ebnfNode{item}}
+		case "+":
+			item = ebnfNode{kind: ebnfPlus, children: []ebnfNode{item}}
+		case "?":
+			item = ebnfNode{kind: ebnfOptional, children: []ebnfNode{item}}
+		default:
+			return item, nil
+		}
+		ep.pos++
+	}
+}
+
+// ebnfDesugarer rewrites EBNF bodies into plain productions, adding helper non terminals named after the head of
+// the production, like "args#1".
+type ebnfDesugarer struct {
+	helpersOf   map[grammarSymbol]int
+	productions []Production
+}
+
+func (d *ebnfDesugarer) newHelper(head grammarSymbol) grammarSymbol {
+	d.helpersOf[head]++
+	return grammarSymbol(fmt.Sprintf("%v#%v", head, d.helpersOf[head]))
+}
+
+func alternativesOf(n ebnfNode) []ebnfNode {
+	if n.kind == ebnfAlternation {
+		return n.children
+	}
+	return []ebnfNode{n}
+}
+
+func itemsOf(n ebnfNode) []ebnfNode {
+	if n.kind == ebnfSequence {
+		return n.children
+	}
+	return []ebnfNode{n}
+}
+
+func (d *ebnfDesugarer) bodyOf(head grammarSymbol, sequence ebnfNode) []grammarSymbol {
+	body := make([]grammarSymbol, 0)
+	for _, item := range itemsOf(sequence) {
+		body = append(body, d.symbolOf(head, item))
+	}
+	return body
+}
+
+// symbolOf returns the symbol standing for an item of an EBNF body. Repetitions build a node labelled "list" with
+// one child per repetition, and an optional item that is missing builds nothing. A group builds a node labelled
+// "group" with its symbols as children, unless it only has one.
+func (d *ebnfDesugarer) symbolOf(head grammarSymbol, n ebnfNode) grammarSymbol {
+	if n.kind == ebnfSymbol {
+		return n.symbol
+	}
+
+	helper := d.newHelper(head)
+	switch n.kind {
+	case ebnfStar, ebnfPlus, ebnfOptional:
+		item := d.symbolOf(head, n.children[0])
+		switch n.kind {
+		case ebnfStar:
+			d.productions = append(d.productions,
+				Production{Head: helper, Body: []grammarSymbol{}, Rule: SemanticRule{Type: "tree", RootLabel: "list", Children: []int{}}},
+				Production{Head: helper, Body: []grammarSymbol{helper, item}, Rule: SemanticRule{Type: "append", Children: []int{0, 1}}})
+		case ebnfPlus:
+			d.productions = append(d.productions,
+				Production{Head: helper, Body: []grammarSymbol{item}, Rule: SemanticRule{Type: "tree", RootLabel: "list", Children: []int{0}}},
+				Production{Head: helper, Body: []grammarSymbol{helper, item}, Rule: SemanticRule{Type: "append", Children: []int{0, 1}}})
+		case ebnfOptional:
+			d.productions = append(d.productions,
+				Production{Head: helper, Body: []grammarSymbol{}},
+				Production{Head: helper, Body: []grammarSymbol{item}})
+		}
+	default:
+		for _, alternative := range alternativesOf(n) {
+			body := d.bodyOf(head, alternative)
+			d.productions = append(d.productions, Production{Head: helper, Body: body, Rule: groupRule(body)})
+		}
+	}
+	return helper
+}
+
+// groupRule returns the rule of a group with the given body, which builds a node labelled "group" with its symbols
+// as children, or passes on the node of its symbol if it only has one.
+func groupRule(body []grammarSymbol) SemanticRule {
+	if len(body) <= 1 {
+		return SemanticRule{}
+	}
+	children := make([]int, len(body))
+	for i := range children {
+		children[i] = i
+	}
+	return SemanticRule{Type: "tree", RootLabel: "group", Children: children}
+}
+
+// desugar returns the grammar with the productions having an EBNF body rewritten into plain productions. Each
+// alternative at the top of an EBNF body becomes a production with the rule of the original one, whose children
+// are the items of the alternative, so Validate reports the alternatives which do not have the children of the
+// rule. The helper productions come after all the others.
+func (g Grammar) desugar() (Grammar, error) {
+	d := ebnfDesugarer{helpersOf: make(map[grammarSymbol]int)}
+	productions := make([]Production, 0, len(g.Productions))
+	for i, p := range g.Productions {
+		if p.EBNF == "" {
+			productions = append(productions, p)
+			continue
+		}
+		if len(p.Body) > 0 {
+			return g, fmt.Errorf("production %v of %v has both a body and an EBNF body", i, p.Head)
+		}
+		body, err := parseEbnf(p.EBNF)
+		if err != nil {
+			return g, fmt.Errorf("EBNF body of production %v of %v: %v", i, p.Head, err)
+		}
+		for _, alternative := range alternativesOf(body) {
+			productions = append(productions, Production{Head: p.Head, Body: d.bodyOf(p.Head, alternative), Rule: p.Rule, Precedence: p.Precedence})
+		}
+	}
+	g.Productions = append(productions, d.productions...)
+	return g, nil
+}
@@ -0,0 +1,154 @@
+package parser
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/SaurabhJha/lexpar/lexer"
+)
+
+func TestScanEbnf(t *testing.T) {
+	var testData = []struct {
+		body           string
+		expectedTokens []string
+	}{
+		{"expr '+' term", []string{"expr", "'+'", "term"}},
+		{"expr'", []string{"expr'"}},
+		{"(',' id)* | '('?", []string{"(", "','", "id", ")", "*", "|", "'('", "?"}},
+		{"  ", []string{}},
+	}
+
+	for _, test := range testData {
+		tokens, err := scanEbnf(test.body)
+		if err != nil {
+			t.Errorf("Expected %q to be scanned, got %v", test.body, err)
+		} else if !reflect.DeepEqual(tokens, test.expectedTokens) {
+			t.Errorf("Expected %q to be scanned into %q, got %q", test.body, test.expectedTokens, tokens)
+		}
+	}
+}
+
+func TestDesugar(t *testing.T) {
+	var testData = []struct {
+		ebnf                string
+		expectedProductions []Production
+	}{
+		{
+			"id*",
+			[]Production{
+				{Head: "s", Body: []grammarSymbol{"s#1"}, Rule: SemanticRule{Type: "copy", Children: []int{0}}},
+				{Head: "s#1", Body: []grammarSymbol{}, Rule: SemanticRule{Type: "tree", RootLabel: "list", Children: []int{}}},
+				{Head: "s#1", Body: []grammarSymbol{"s#1", "id"}, Rule: SemanticRule{Type: "append", Children: []int{0, 1}}},
+			},
+		},
+		{
+			"'(' id+ ')' | id?",
+			[]Production{
+				{Head: "s", Body: []grammarSymbol{"(", "s#1", ")"}, Rule: SemanticRule{Type: "copy", Children: []int{0}}},
+				{Head: "s", Body: []grammarSymbol{"s#2"}, Rule: SemanticRule{Type: "copy", Children: []int{0}}},
+				{Head: "s#1", Body: []grammarSymbol{"id"}, Rule: SemanticRule{Type: "tree", RootLabel: "list", Children: []int{0}}},
+				{Head: "s#1", Body: []grammarSymbol{"s#1", "id"}, Rule: SemanticRule{Type: "append", Children: []int{0, 1}}},
+				{Head: "s#2", Body: []grammarSymbol{}},
+				{Head: "s#2", Body: []grammarSymbol{"id"}},
+			},
+		},
+		{
+			"expr' 'b c'",
+			[]Production{
+				{Head: "s", Body: []grammarSymbol{"expr'", "b c"}, Rule: SemanticRule{Type: "copy", Children: []int{0}}},
+			},
+		},
+		{
+			"id id | id ',' id | id",
+			[]Production{
+				{Head: "s", Body: []grammarSymbol{"id", "id"}, Rule: SemanticRule{Type: "copy", Children: []int{0}}},
+				{Head: "s", Body: []grammarSymbol{"id", ",", "id"}, Rule: SemanticRule{Type: "copy", Children: []int{0}}},
+				{Head: "s", Body: []grammarSymbol{"id"}, Rule: SemanticRule{Type: "copy", Children: []int{0}}},
+			},
+		},
+		{
+			"id (',' id | id)*",
+			[]Production{
+				{Head: "s", Body: []grammarSymbol{"id", "s#1"}, Rule: SemanticRule{Type: "copy", Children: []int{0}}},
+				{Head: "s#2", Body: []grammarSymbol{",", "id"}, Rule: SemanticRule{Type: "tree", RootLabel: "group", Children: []int{0, 1}}},
+				{Head: "s#2", Body: []grammarSymbol{"id"}},
+				{Head: "s#1", Body: []grammarSymbol{}, Rule: SemanticRule{Type: "tree", RootLabel: "list", Children: []int{}}},
+				{Head: "s#1", Body: []grammarSymbol{"s#1", "s#2"}, Rule: SemanticRule{Type: "append", Children: []int{0, 1}}},
+			},
+		},
+	}
+
+	for _, test := range testData {
+		g := Grammar{Start: "s", Productions: []Production{{Head: "s", Rule: SemanticRule{Type: "copy", Children: []int{0}}, EBNF: test.ebnf}}}
+		desugared, err := g.desugar()
+		if err != nil {
+			t.Errorf("Expected %q to be desugared, got %v", test.ebnf, err)
+		} else if !reflect.DeepEqual(desugared.Productions, test.expectedProductions) {
+			t.Errorf("Expected %q to be desugared into %v, got %v", test.ebnf, test.expectedProductions, desugared.Productions)
+		}
+	}
+}
+
+func TestDesugarErrors(t *testing.T) {
+	var testData = []struct {
+		production    Production
+		expectedError string
+	}{
+		{Production{Head: "s", EBNF: "(id"}, "missing )"},
+		{Production{Head: "s", EBNF: "id)"}, "unexpected )"},
+		{Production{Head: "s", EBNF: "* id"}, "* has nothing to repeat"},
+		{Production{Head: "s", EBNF: "'id"}, "unterminated quoted symbol at 0"},
+		{Production{Head: "s", EBNF: "''"}, "empty quoted symbol at 0"},
+		{Production{Head: "s", Body: []grammarSymbol{"id"}, EBNF: "id"}, "production 0 of s has both a body and an EBNF body"},
+	}
+
+	for _, test := range testData {
+		g := Grammar{Start: "s", Productions: []Production{test.production}}
+		_, err := g.desugar()
+		if err == nil || !strings.HasSuffix(err.Error(), test.expectedError) {
+			t.Errorf("Expected error %q for %q, got %v", test.expectedError, test.production.EBNF, err)
+		}
+	}
+}
+
+func TestCompileEbnf(t *testing.T) {
+	var g Grammar
+	g.Start = "list'"
+	g.Productions = []Production{
+		{Head: "list'", Body: []grammarSymbol{"list"}},
+		{Head: "list", Rule: SemanticRule{Type: "copy", Children: []int{1}}, EBNF: "'[' item* ']'"},
+		{Head: "item", EBNF: "id | number | list"},
+	}
+	var testData = []struct {
+		input        string
+		expectedTree string
+	}{
+		{"[ ]", "list"},
+		{"[ id number ]", "(list id number)"},
+		{"[ id [ number ] [ ] ]", "(list id (list number) list)"},
+	}
+
+	for _, mode := range []ConstructionMode{CanonicalLR1, LALR1} {
+		g.Mode = mode
+		ps, err := g.compile()
+		if err != nil {
+			t.Fatalf("Expected %v parser to compile, got %v", mode, err)
+		}
+		for _, test := range testData {
+			tokens := make([]lexer.Token, 0)
+			for _, tokenType := range strings.Fields(test.input) {
+				tokens = append(tokens, lexer.Token{TokenType: tokenType, Lexeme: tokenType})
+			}
+			tokens = append(tokens, lexer.Token{TokenType: "$", Lexeme: "$"})
+
+			ast := ps.parse(tokens)
+			if !ps.accepted {
+				t.Errorf("Expected %v parser to accept %v", mode, test.input)
+			} else if got := formatTree(ast, ps.gStack.top()); got != test.expectedTree {
+				t.Errorf("Expected %v parser to build %v on input %v, got %v", mode, test.expectedTree, test.input, got)
+			}
+			ps.reset()
+		}
+	}
+}
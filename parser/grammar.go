@@ -1,46 +1,84 @@
 package parser
 
-import "reflect"
+import (
+	"fmt"
+	"reflect"
+)
 
 type grammarSymbol string
 
-// SemanticRule is a syntax directed definition (SDD) associated with a grammar.
+// SemanticRule is a syntax directed definition (SDD) associated with a grammar. A root label written like "$1" is
+// the label of the node of body symbol 1, which is the lexeme of a token. Attributes are attached to the node built
+// by the rule, and their values can refer to body symbols the same way.
 type SemanticRule struct {
-	Type      string
-	RootLabel string
-	Children  []int
+	Type       string
+	RootLabel  string
+	Children   []int
+	Attributes map[string]string
 }
 
-func (rule SemanticRule) isEmpty() bool {
-	return reflect.DeepEqual(
-		rule,
-		SemanticRule{
-			"",
-			"",
-			nil,
-		},
-	)
-}
-
-// Production is a grammar production in Backus-Naur form.
+// Production is a grammar production in Backus-Naur form. Precedence optionally names a terminal whose
+// precedence the production takes, like %prec in yacc. EBNF can be given instead of Body to write the body in
+// extended Backus-Naur form, with repetitions, optional items, groups and alternatives.
 type Production struct {
-	Head grammarSymbol
-	Body []grammarSymbol
-	Rule SemanticRule
+	Head       grammarSymbol
+	Body       []grammarSymbol
+	Rule       SemanticRule
+	Precedence grammarSymbol
+	EBNF       string
 }
 
-func (p Production) getFirstBodySymbol() grammarSymbol {
-	if len(p.Body) == 0 {
-		return ""
-	}
+// ConstructionMode selects how the parsing table of a grammar is built.
+type ConstructionMode string
 
-	return p.Body[0]
-}
+const (
+	// CanonicalLR1 builds a canonical LR(1) parsing table. It is used when no mode is given.
+	CanonicalLR1 ConstructionMode = "lr1"
+	// LALR1 merges the states of the canonical LR(1) automaton having the same core, as yacc does. The table is
+	// much smaller, but some LR(1) grammars get reduce-reduce conflicts. The whole canonical LR(1) automaton is
+	// built before merging, so that the conflicts introduced by the merge can be told apart: building the table
+	// takes as much time and memory as CanonicalLR1, and only the resulting table is smaller.
+	LALR1 ConstructionMode = "lalr1"
+)
 
-// Grammar is a context-free grammar which is a list of productions and a start symbol.
+// Grammar is a context-free grammar which is a list of productions and a start symbol. Mode selects how its
+// parsing table is built. Precedence lists precedence levels from the lowest to the highest, and is used to
+// settle shift-reduce conflicts.
 type Grammar struct {
 	Productions []Production
 	Start       grammarSymbol
+	Mode        ConstructionMode
+	Precedence  []PrecedenceLevel
+}
+
+// SetStartSymbol sets the start symbol of the grammar.
+func (g *Grammar) SetStartSymbol(s string) {
+	g.Start = grammarSymbol(s)
+}
+
+// AddProduction adds a production at the end of the grammar. An empty precedence leaves the precedence of the
+// production to its body.
+func (g *Grammar) AddProduction(head string, body []string, rule SemanticRule, precedence string) {
+	symbols := make([]grammarSymbol, len(body))
+	for i, s := range body {
+		symbols[i] = grammarSymbol(s)
+	}
+	g.Productions = append(g.Productions, Production{Head: grammarSymbol(head), Body: symbols, Rule: rule, Precedence: grammarSymbol(precedence)})
+}
+
+// AddEbnfProduction adds a production with an EBNF body at the end of the grammar, like AddProduction does for
+// plain bodies.
+func (g *Grammar) AddEbnfProduction(head string, ebnf string, rule SemanticRule, precedence string) {
+	g.Productions = append(g.Productions, Production{Head: grammarSymbol(head), EBNF: ebnf, Rule: rule, Precedence: grammarSymbol(precedence)})
+}
+
+// AddPrecedenceLevel adds a precedence level above all the others.
+func (g *Grammar) AddPrecedenceLevel(associativity Associativity, terminals []string) {
+	symbols := make([]grammarSymbol, len(terminals))
+	for i, s := range terminals {
+		symbols[i] = grammarSymbol(s)
+	}
+	g.Precedence = append(g.Precedence, PrecedenceLevel{associativity, symbols})
 }
 
 func (g Grammar) isTerminal(s grammarSymbol) bool {
@@ -63,98 +101,205 @@ func (g Grammar) getProductionsOfSymbol(s grammarSymbol) []Production {
 	return productions
 }
 
-func (g Grammar) computeFirstSet(s grammarSymbol) setOfSymbols {
-	if g.isTerminal(s) {
-		return setOfSymbols{s: true}
+func (g Grammar) getProductionNumber(p Production) int {
+	for i := range g.Productions {
+		if reflect.DeepEqual(g.Productions[i], p) {
+			return i
+		}
 	}
+	return -1
+}
 
-	firstSet := make(setOfSymbols)
-	for _, production := range g.getProductionsOfSymbol(s) {
-		firstBodySymbol := production.getFirstBodySymbol()
-		if firstBodySymbol != "" && firstBodySymbol != production.Head {
-			firstSetOfBody := g.computeFirstSet(firstBodySymbol)
+// findProduction returns the number of the production of head with body.
+func (g Grammar) findProduction(head string, body []string) (int, error) {
+	for i, p := range g.Productions {
+		if string(p.Head) != head || len(p.Body) != len(body) {
+			continue
+		}
+		matches := true
+		for j, s := range p.Body {
+			if string(s) != body[j] {
+				matches = false
+				break
+			}
+		}
+		if matches {
+			return i, nil
+		}
+	}
+	production := Production{Head: grammarSymbol(head)}
+	for _, s := range body {
+		production.Body = append(production.Body, grammarSymbol(s))
+	}
+	return -1, fmt.Errorf("grammar has no production %v", formatProduction(production))
+}
+
+// grammarIndex holds facts about a grammar that are looked up over and over while building its parsing table.
+type grammarIndex struct {
+	g               Grammar
+	productionsOf   map[grammarSymbol][]int
+	nullable        setOfSymbols
+	firstSets       map[grammarSymbol]setOfSymbols
+	firstSetsOfRest map[lrItem]firstSetOfRest
+	precedenceOf    map[grammarSymbol]int
+	associativityOf map[grammarSymbol]Associativity
+}
+
+func (g Grammar) index() grammarIndex {
+	gi := grammarIndex{
+		g:               g,
+		productionsOf:   make(map[grammarSymbol][]int),
+		nullable:        make(setOfSymbols),
+		firstSets:       make(map[grammarSymbol]setOfSymbols),
+		firstSetsOfRest: make(map[lrItem]firstSetOfRest),
+	}
+	for i, p := range g.Productions {
+		gi.productionsOf[p.Head] = append(gi.productionsOf[p.Head], i)
+		gi.firstSets[p.Head] = make(setOfSymbols)
+	}
+
+	// Nullable non terminals and FIRST sets are computed together, going over the productions until nothing
+	// changes. Unlike a recursive computation, this terminates on any kind of recursion.
+	for changed := true; changed; {
+		changed = false
+		for _, p := range g.Productions {
+			firstSetOfBody, bodyIsNullable := gi.computeFirstSetOfSequence(p.Body)
+			firstSet := gi.firstSets[p.Head]
+			before := len(firstSet)
 			firstSet.unionWith(&firstSetOfBody)
+			if len(firstSet) != before {
+				changed = true
+			}
+			if bodyIsNullable && !gi.nullable.has(p.Head) {
+				gi.nullable.add(p.Head)
+				changed = true
+			}
 		}
 	}
 
-	return firstSet
+	return gi
+}
+
+func (gi *grammarIndex) isTerminal(s grammarSymbol) bool {
+	_, ok := gi.productionsOf[s]
+	return !ok
 }
 
-func (g Grammar) computeFollowSet(s grammarSymbol) setOfSymbols {
-	if g.isTerminal(s) {
-		return setOfSymbols{}
+func (gi *grammarIndex) firstSet(s grammarSymbol) setOfSymbols {
+	if gi.isTerminal(s) {
+		return setOfSymbols{s: true}
 	}
+	return gi.firstSets[s]
+}
 
-	followSet := setOfSymbols{}
-	if s == g.Start {
-		followSet.add("$")
+// computeFollowSets returns the terminals that can come right after each non terminal in a sentential form. The
+// FOLLOW sets of all non terminals are computed together, going over the productions until none of the sets grows.
+func (gi *grammarIndex) computeFollowSets() map[grammarSymbol]setOfSymbols {
+	followSets := make(map[grammarSymbol]setOfSymbols)
+	for head := range gi.productionsOf {
+		followSets[head] = make(setOfSymbols)
 	}
-	for _, p := range g.Productions {
-		for i, bodySymbol := range p.Body {
-			if bodySymbol == s {
-				if i == len(p.Body)-1 {
-					followSetOfHead := g.computeFollowSet(p.Head)
+	if followSetOfStart, ok := followSets[gi.g.Start]; ok {
+		followSetOfStart.add("$")
+	}
+	for changed := true; changed; {
+		changed = false
+		for _, p := range gi.g.Productions {
+			for i, bodySymbol := range p.Body {
+				if gi.isTerminal(bodySymbol) {
+					continue
+				}
+				followSet := followSets[bodySymbol]
+				before := len(followSet)
+				firstSetOfRest, restIsNullable := gi.computeFirstSetOfSequence(p.Body[i+1:])
+				followSet.unionWith(&firstSetOfRest)
+				if restIsNullable {
+					followSetOfHead := followSets[p.Head]
 					followSet.unionWith(&followSetOfHead)
-				} else {
-					firstSetOfNextSym := g.computeFirstSet(p.Body[i+1])
-					followSet.unionWith(&firstSetOfNextSym)
+				}
+				if len(followSet) != before {
+					changed = true
 				}
 			}
 		}
 	}
-	return followSet
+	return followSets
 }
 
-func (g Grammar) getProductionNumber(p Production) int {
-	for i := range g.Productions {
-		if reflect.DeepEqual(g.Productions[i], p) {
-			return i
+// computeFirstSetOfSequence returns the terminals that can start a string derived from a sequence of symbols, and
+// whether the sequence can derive the empty string.
+func (gi *grammarIndex) computeFirstSetOfSequence(symbols []grammarSymbol) (setOfSymbols, bool) {
+	firstSet := make(setOfSymbols)
+	for _, s := range symbols {
+		firstSetOfSymbol := gi.firstSet(s)
+		firstSet.unionWith(&firstSetOfSymbol)
+		if !gi.nullable.has(s) {
+			return firstSet, false
 		}
 	}
-	return -1
+	return firstSet, true
 }
 
-func (g Grammar) compile() parser {
-	table := make(parsingTable)
-	startProduction := g.getProductionsOfSymbol(g.Start)[0]
-	startItem := lrItem{g, startProduction, 0, map[grammarSymbol]bool{"$": true}}
-	startItemSet := startItem.computeClosureSet()
-	q := make(queueOfItemSets, 0, 10)
-	q.enqueue(startItemSet)
-	seen := make(seenLrItemSets, 0, 100)
-	seen.add(startItemSet)
-
-	for !q.empty() {
-		currentItemSet := q.dequeue()
-		currentState := seen.getStateNumber(currentItemSet)
-
-		// Add shift moves.
-		for symbol := range currentItemSet.getNextSymbols() {
-			nextItemSet := currentItemSet.getNextItemSet(symbol)
-			if !seen.has(nextItemSet) {
-				q.enqueue(nextItemSet)
-				seen.add(nextItemSet)
-			}
-			nextState := seen.getStateNumber(nextItemSet)
-			table.addShiftMove(currentState, nextState, symbol)
-		}
+// firstSetOfRest is the FIRST set of what follows the symbol after the dot of an item.
+type firstSetOfRest struct {
+	firstSet setOfSymbols
+	nullable bool
+}
 
-		// Add reduce and accept moves.
-		for _, item := range currentItemSet.itemSet {
-			if item.getNextSymbol() == "" {
-				productionNumber := item.g.getProductionNumber(item.p)
-				for symbol := range item.followSet {
-					if productionNumber == 0 && symbol == "$" {
-						table.addAcceptMove(currentState)
-					} else {
-						table.addReduceMove(currentState, productionNumber, symbol)
-					}
-				}
+// getFirstSetOfRest returns the FIRST set of the body of an item after the symbol following the dot. It is needed
+// for every item of every closure, so it is computed once per item.
+func (gi *grammarIndex) getFirstSetOfRest(l lrItem) firstSetOfRest {
+	if rest, ok := gi.firstSetsOfRest[l]; ok {
+		return rest
+	}
+	var rest firstSetOfRest
+	rest.firstSet, rest.nullable = gi.computeFirstSetOfSequence(gi.g.Productions[l.production].Body[l.pos+1:])
+	gi.firstSetsOfRest[l] = rest
+	return rest
+}
+
+// compile builds the parsing table of the grammar. If the grammar has conflicts, the error is a *ConflictError
+// listing all of them.
+func (g Grammar) compile() (parser, error) {
+	g, err := g.desugar()
+	if err != nil {
+		return parser{}, err
+	}
+	gi := g.index()
+	if err := gi.indexPrecedence(); err != nil {
+		return parser{}, err
+	}
+	startProduction := gi.productionsOf[g.Start][0]
+	automaton := gi.computeCanonicalCollection(startProduction)
+
+	var table parsingTable
+	var conflicts []Conflict
+	switch g.Mode {
+	case CanonicalLR1, "":
+		table, conflicts = automaton.buildParsingTable(&gi, startProduction)
+	case LALR1:
+		merged, mergeConflicts := automaton.mergeCores(g)
+		table, conflicts = merged.buildParsingTable(&gi, startProduction)
+		introducedByMerge := make(map[int]setOfSymbols)
+		for _, c := range mergeConflicts {
+			symbols, ok := introducedByMerge[c.State]
+			if !ok {
+				symbols = make(setOfSymbols)
+				introducedByMerge[c.State] = symbols
 			}
+			symbols.add(c.Symbol)
 		}
+		for i := range conflicts {
+			conflicts[i].IntroducedByMerge = introducedByMerge[conflicts[i].State][conflicts[i].Symbol]
+		}
+	default:
+		return parser{}, fmt.Errorf("unknown parsing table construction mode %q", g.Mode)
+	}
+	if len(conflicts) > 0 {
+		return parser{}, &ConflictError{conflicts}
 	}
 
 	var ps parser
 	ps.init(table, g)
-	return ps
+	return ps, nil
 }
@@ -2,24 +2,60 @@ package parser
 
 import (
 	"reflect"
+	"strings"
 	"testing"
 
 	"github.com/SaurabhJha/lexpar/lexer"
 )
 
-func TestGetFirstBody(t *testing.T) {
+// nullableGrammar is a grammar for function calls with optional arguments and an optional "!" and "?" after the
+// call, where args, params, bang and question can be empty.
+var nullableGrammar = Grammar{
+	Start: "call'",
+	Productions: []Production{
+		{Head: "call'", Body: []grammarSymbol{"call"}},
+		{Head: "call", Body: []grammarSymbol{"id", "(", "args", ")", "params"}, Rule: SemanticRule{Type: "tree", RootLabel: "call", Children: []int{0, 2}}},
+		{Head: "args", Body: []grammarSymbol{}},
+		{Head: "args", Body: []grammarSymbol{"arglist"}},
+		{Head: "arglist", Body: []grammarSymbol{"arglist", ",", "id"}, Rule: SemanticRule{Type: "tree", RootLabel: "args", Children: []int{0, 2}}},
+		{Head: "arglist", Body: []grammarSymbol{"id"}},
+		{Head: "params", Body: []grammarSymbol{"bang", "question"}},
+		{Head: "bang", Body: []grammarSymbol{}},
+		{Head: "bang", Body: []grammarSymbol{"!"}},
+		{Head: "question", Body: []grammarSymbol{}},
+		{Head: "question", Body: []grammarSymbol{"?"}},
+	},
+}
+
+func TestComputeNullable(t *testing.T) {
+	gi := nullableGrammar.index()
+	expected := setOfSymbols{"args": true, "params": true, "bang": true, "question": true}
+	if !reflect.DeepEqual(gi.nullable, expected) {
+		t.Errorf("Expected nullable non terminals %v, got %v", expected, gi.nullable)
+	}
+}
+
+func TestComputeFirstSetOfSequence(t *testing.T) {
+	gi := nullableGrammar.index()
+
 	var testData = []struct {
-		p    Production
-		want grammarSymbol
+		input            []grammarSymbol
+		expected         setOfSymbols
+		expectedNullable bool
 	}{
-		{Production{"expr", []grammarSymbol{"expr", "+", "term"}, SemanticRule{"", "", []int{}}}, "expr"},
-		{Production{"term", []grammarSymbol{"factor"}, SemanticRule{"", "", []int{}}}, "factor"},
-		{Production{"expr'", []grammarSymbol{}, SemanticRule{"", "", []int{}}}, ""},
+		{[]grammarSymbol{}, setOfSymbols{}, true},
+		{[]grammarSymbol{"args"}, setOfSymbols{"id": true}, true},
+		{[]grammarSymbol{"args", ")"}, setOfSymbols{"id": true, ")": true}, false},
+		{[]grammarSymbol{"bang", "question"}, setOfSymbols{"!": true, "?": true}, true},
+		{[]grammarSymbol{"params", "args", "("}, setOfSymbols{"!": true, "?": true, "id": true, "(": true}, false},
+		{[]grammarSymbol{"(", "args"}, setOfSymbols{"(": true}, false},
 	}
 
 	for _, test := range testData {
-		if got := test.p.getFirstBodySymbol(); got != test.want {
-			t.Errorf("p.getFirstBodySymbol() = %v, expected %v", got, test.want)
+		got, nullable := gi.computeFirstSetOfSequence(test.input)
+		if !reflect.DeepEqual(got, test.expected) || nullable != test.expectedNullable {
+			t.Errorf("Expected computeFirstSetOfSequence(%v) = %v %v, got %v %v",
+				test.input, test.expected, test.expectedNullable, got, nullable)
 		}
 	}
 }
@@ -28,13 +64,13 @@ func TestGetProductionsOfSymbol(t *testing.T) {
 	var g Grammar
 	g.Start = "expr'"
 	g.Productions = []Production{
-		{"expr'", []grammarSymbol{"expr"}, SemanticRule{"", "", []int{}}},
-		{"expr", []grammarSymbol{"expr", "+", "term"}, SemanticRule{"", "", []int{}}},
-		{"expr", []grammarSymbol{"term"}, SemanticRule{"", "", []int{}}},
-		{"term", []grammarSymbol{"term", "*", "factor"}, SemanticRule{"", "", []int{}}},
-		{"term", []grammarSymbol{"factor"}, SemanticRule{"", "", []int{}}},
-		{"factor", []grammarSymbol{"number"}, SemanticRule{"", "", []int{}}},
-		{"factor", []grammarSymbol{"(", "expr", ")"}, SemanticRule{"", "", []int{}}},
+		{Head: "expr'", Body: []grammarSymbol{"expr"}, Rule: SemanticRule{Children: []int{}}},
+		{Head: "expr", Body: []grammarSymbol{"expr", "+", "term"}, Rule: SemanticRule{Children: []int{}}},
+		{Head: "expr", Body: []grammarSymbol{"term"}, Rule: SemanticRule{Children: []int{}}},
+		{Head: "term", Body: []grammarSymbol{"term", "*", "factor"}, Rule: SemanticRule{Children: []int{}}},
+		{Head: "term", Body: []grammarSymbol{"factor"}, Rule: SemanticRule{Children: []int{}}},
+		{Head: "factor", Body: []grammarSymbol{"number"}, Rule: SemanticRule{Children: []int{}}},
+		{Head: "factor", Body: []grammarSymbol{"(", "expr", ")"}, Rule: SemanticRule{Children: []int{}}},
 	}
 
 	var testData = []struct {
@@ -66,13 +102,13 @@ func TestComputeFirstSet(t *testing.T) {
 	var g Grammar
 	g.Start = "expr'"
 	g.Productions = []Production{
-		{"expr'", []grammarSymbol{"expr"}, SemanticRule{"", "", []int{}}},
-		{"expr", []grammarSymbol{"expr", "+", "term"}, SemanticRule{"", "", []int{}}},
-		{"expr", []grammarSymbol{"term"}, SemanticRule{"", "", []int{}}},
-		{"term", []grammarSymbol{"term", "*", "factor"}, SemanticRule{"", "", []int{}}},
-		{"term", []grammarSymbol{"factor"}, SemanticRule{"", "", []int{}}},
-		{"factor", []grammarSymbol{"number"}, SemanticRule{"", "", []int{}}},
-		{"factor", []grammarSymbol{"(", "expr", ")"}, SemanticRule{"", "", []int{}}},
+		{Head: "expr'", Body: []grammarSymbol{"expr"}, Rule: SemanticRule{Children: []int{}}},
+		{Head: "expr", Body: []grammarSymbol{"expr", "+", "term"}, Rule: SemanticRule{Children: []int{}}},
+		{Head: "expr", Body: []grammarSymbol{"term"}, Rule: SemanticRule{Children: []int{}}},
+		{Head: "term", Body: []grammarSymbol{"term", "*", "factor"}, Rule: SemanticRule{Children: []int{}}},
+		{Head: "term", Body: []grammarSymbol{"factor"}, Rule: SemanticRule{Children: []int{}}},
+		{Head: "factor", Body: []grammarSymbol{"number"}, Rule: SemanticRule{Children: []int{}}},
+		{Head: "factor", Body: []grammarSymbol{"(", "expr", ")"}, Rule: SemanticRule{Children: []int{}}},
 	}
 
 	var testData = []struct {
@@ -85,9 +121,26 @@ func TestComputeFirstSet(t *testing.T) {
 		{"factor", setOfSymbols{"(": true, "number": true}},
 	}
 
+	gi := g.index()
 	for _, test := range testData {
-		if got := g.computeFirstSet(test.input); !reflect.DeepEqual(got, test.expected) {
-			t.Errorf("Expected computeFirstSet(%q) = %v, got %v", test.input, test.expected, got)
+		if got := gi.firstSet(test.input); !reflect.DeepEqual(got, test.expected) {
+			t.Errorf("Expected firstSet(%q) = %v, got %v", test.input, test.expected, got)
+		}
+	}
+
+	testData = []struct {
+		input    grammarSymbol
+		expected setOfSymbols
+	}{
+		{"args", setOfSymbols{"id": true}},
+		{"params", setOfSymbols{"!": true, "?": true}},
+		{"call'", setOfSymbols{"id": true}},
+	}
+
+	gi = nullableGrammar.index()
+	for _, test := range testData {
+		if got := gi.firstSet(test.input); !reflect.DeepEqual(got, test.expected) {
+			t.Errorf("Expected firstSet(%q) = %v, got %v", test.input, test.expected, got)
 		}
 	}
 }
@@ -96,13 +149,13 @@ func TestComputeFollowSet(t *testing.T) {
 	var g Grammar
 	g.Start = "expr'"
 	g.Productions = []Production{
-		{"expr'", []grammarSymbol{"expr"}, SemanticRule{"", "", []int{}}},
-		{"expr", []grammarSymbol{"expr", "+", "term"}, SemanticRule{"", "", []int{}}},
-		{"expr", []grammarSymbol{"term"}, SemanticRule{"", "", []int{}}},
-		{"term", []grammarSymbol{"term", "*", "factor"}, SemanticRule{"", "", []int{}}},
-		{"term", []grammarSymbol{"factor"}, SemanticRule{"", "", []int{}}},
-		{"factor", []grammarSymbol{"number"}, SemanticRule{"", "", []int{}}},
-		{"factor", []grammarSymbol{"(", "expr", ")"}, SemanticRule{"", "", []int{}}},
+		{Head: "expr'", Body: []grammarSymbol{"expr"}, Rule: SemanticRule{Children: []int{}}},
+		{Head: "expr", Body: []grammarSymbol{"expr", "+", "term"}, Rule: SemanticRule{Children: []int{}}},
+		{Head: "expr", Body: []grammarSymbol{"term"}, Rule: SemanticRule{Children: []int{}}},
+		{Head: "term", Body: []grammarSymbol{"term", "*", "factor"}, Rule: SemanticRule{Children: []int{}}},
+		{Head: "term", Body: []grammarSymbol{"factor"}, Rule: SemanticRule{Children: []int{}}},
+		{Head: "factor", Body: []grammarSymbol{"number"}, Rule: SemanticRule{Children: []int{}}},
+		{Head: "factor", Body: []grammarSymbol{"(", "expr", ")"}, Rule: SemanticRule{Children: []int{}}},
 	}
 
 	var testData = []struct {
@@ -114,9 +167,30 @@ func TestComputeFollowSet(t *testing.T) {
 		{"factor", setOfSymbols{"+": true, "*": true, ")": true, "$": true}},
 	}
 
+	gi := g.index()
+	followSets := gi.computeFollowSets()
 	for _, test := range testData {
-		if got := g.computeFollowSet(test.input); !reflect.DeepEqual(got, test.expected) {
-			t.Errorf("Expected computeFirstSet(%q) = %v, got %v", test.input, test.expected, got)
+		if got := followSets[test.input]; !reflect.DeepEqual(got, test.expected) {
+			t.Errorf("Expected FOLLOW(%q) = %v, got %v", test.input, test.expected, got)
+		}
+	}
+
+	testData = []struct {
+		input    grammarSymbol
+		expected setOfSymbols
+	}{
+		{"args", setOfSymbols{")": true}},
+		{"arglist", setOfSymbols{")": true, ",": true}},
+		{"params", setOfSymbols{"$": true}},
+		{"bang", setOfSymbols{"?": true, "$": true}},
+		{"question", setOfSymbols{"$": true}},
+	}
+
+	gi = nullableGrammar.index()
+	followSets = gi.computeFollowSets()
+	for _, test := range testData {
+		if got := followSets[test.input]; !reflect.DeepEqual(got, test.expected) {
+			t.Errorf("Expected FOLLOW(%q) = %v, got %v", test.input, test.expected, got)
 		}
 	}
 }
@@ -125,23 +199,23 @@ func TestGetProductionNumber(t *testing.T) {
 	var g Grammar
 	g.Start = "expr'"
 	g.Productions = []Production{
-		{"expr'", []grammarSymbol{"expr"}, SemanticRule{"", "", []int{}}},
-		{"expr", []grammarSymbol{"expr", "+", "term"}, SemanticRule{"", "", []int{}}},
-		{"expr", []grammarSymbol{"term"}, SemanticRule{"", "", []int{}}},
-		{"term", []grammarSymbol{"term", "*", "factor"}, SemanticRule{"", "", []int{}}},
-		{"term", []grammarSymbol{"factor"}, SemanticRule{"", "", []int{}}},
-		{"factor", []grammarSymbol{"number"}, SemanticRule{"", "", []int{}}},
-		{"factor", []grammarSymbol{"(", "expr", ")"}, SemanticRule{"", "", []int{}}},
+		{Head: "expr'", Body: []grammarSymbol{"expr"}, Rule: SemanticRule{Children: []int{}}},
+		{Head: "expr", Body: []grammarSymbol{"expr", "+", "term"}, Rule: SemanticRule{Children: []int{}}},
+		{Head: "expr", Body: []grammarSymbol{"term"}, Rule: SemanticRule{Children: []int{}}},
+		{Head: "term", Body: []grammarSymbol{"term", "*", "factor"}, Rule: SemanticRule{Children: []int{}}},
+		{Head: "term", Body: []grammarSymbol{"factor"}, Rule: SemanticRule{Children: []int{}}},
+		{Head: "factor", Body: []grammarSymbol{"number"}, Rule: SemanticRule{Children: []int{}}},
+		{Head: "factor", Body: []grammarSymbol{"(", "expr", ")"}, Rule: SemanticRule{Children: []int{}}},
 	}
 
 	var testData = []struct {
 		input    Production
 		expected int
 	}{
-		{Production{"expr", []grammarSymbol{"expr", "+", "term"}, SemanticRule{"", "", []int{}}}, 1},
-		{Production{"term", []grammarSymbol{"term", "*", "factor"}, SemanticRule{"", "", []int{}}}, 3},
-		{Production{"factor", []grammarSymbol{"number"}, SemanticRule{"", "", []int{}}}, 5},
-		{Production{"expr", []grammarSymbol{"factor"}, SemanticRule{"", "", []int{}}}, -1},
+		{Production{Head: "expr", Body: []grammarSymbol{"expr", "+", "term"}, Rule: SemanticRule{Children: []int{}}}, 1},
+		{Production{Head: "term", Body: []grammarSymbol{"term", "*", "factor"}, Rule: SemanticRule{Children: []int{}}}, 3},
+		{Production{Head: "factor", Body: []grammarSymbol{"number"}, Rule: SemanticRule{Children: []int{}}}, 5},
+		{Production{Head: "expr", Body: []grammarSymbol{"factor"}, Rule: SemanticRule{Children: []int{}}}, -1},
 	}
 
 	for _, test := range testData {
@@ -155,13 +229,13 @@ func TestCompile(t *testing.T) {
 	var g Grammar
 	g.Start = "expr'"
 	g.Productions = []Production{
-		{"expr'", []grammarSymbol{"expr"}, SemanticRule{"", "", nil}},
-		{"expr", []grammarSymbol{"expr", "+", "term"}, SemanticRule{"tree", "+", []int{0, 2}}},
-		{"expr", []grammarSymbol{"term"}, SemanticRule{"", "", nil}},
-		{"term", []grammarSymbol{"term", "*", "factor"}, SemanticRule{"tree", "*", []int{0, 2}}},
-		{"term", []grammarSymbol{"factor"}, SemanticRule{"", "", nil}},
-		{"factor", []grammarSymbol{"number"}, SemanticRule{"", "", nil}},
-		{"factor", []grammarSymbol{"(", "expr", ")"}, SemanticRule{"copy", "", []int{1}}},
+		{Head: "expr'", Body: []grammarSymbol{"expr"}, Rule: SemanticRule{}},
+		{Head: "expr", Body: []grammarSymbol{"expr", "+", "term"}, Rule: SemanticRule{Type: "tree", RootLabel: "+", Children: []int{0, 2}}},
+		{Head: "expr", Body: []grammarSymbol{"term"}, Rule: SemanticRule{}},
+		{Head: "term", Body: []grammarSymbol{"term", "*", "factor"}, Rule: SemanticRule{Type: "tree", RootLabel: "*", Children: []int{0, 2}}},
+		{Head: "term", Body: []grammarSymbol{"factor"}, Rule: SemanticRule{}},
+		{Head: "factor", Body: []grammarSymbol{"number"}, Rule: SemanticRule{}},
+		{Head: "factor", Body: []grammarSymbol{"(", "expr", ")"}, Rule: SemanticRule{Type: "copy", Children: []int{1}}},
 	}
 
 	var testData = []struct {
@@ -245,14 +319,20 @@ func TestCompile(t *testing.T) {
 		},
 	}
 
-	ps := g.compile()
-	for _, test := range testData {
-		ps.parse(test.input)
-		if ps.accepted != test.expected {
-			t.Errorf("Expected parser to output %v on input %v, got %v",
-				test.expected, test.input, ps.accepted)
+	for _, mode := range []ConstructionMode{CanonicalLR1, LALR1} {
+		g.Mode = mode
+		ps, err := g.compile()
+		if err != nil {
+			t.Errorf("Expected %v parser to compile, got %v", mode, err)
+		}
+		for _, test := range testData {
+			ps.parse(test.input)
+			if ps.accepted != test.expected {
+				t.Errorf("Expected %v parser to output %v on input %v, got %v",
+					mode, test.expected, test.input, ps.accepted)
+			}
+			ps.reset()
 		}
-		ps.reset()
 	}
 }
 
@@ -260,10 +340,224 @@ func TestCompile1(t *testing.T) {
 	var g Grammar
 	g.Start = "S'"
 	g.Productions = []Production{
-		{"S'", []grammarSymbol{"S"}, SemanticRule{}},
-		{"S", []grammarSymbol{"C", "C"}, SemanticRule{}},
-		{"C", []grammarSymbol{"c", "C"}, SemanticRule{}},
-		{"C", []grammarSymbol{"d"}, SemanticRule{}},
+		{Head: "S'", Body: []grammarSymbol{"S"}},
+		{Head: "S", Body: []grammarSymbol{"C", "C"}},
+		{Head: "C", Body: []grammarSymbol{"c", "C"}},
+		{Head: "C", Body: []grammarSymbol{"d"}},
+	}
+	if _, err := g.compile(); err != nil {
+		t.Errorf("Expected grammar to compile without any conflicts, got %v", err)
+	}
+}
+
+func TestCompileLalrConflict(t *testing.T) {
+	var g Grammar
+	g.Start = "S'"
+	g.Productions = []Production{
+		{Head: "S'", Body: []grammarSymbol{"S"}},
+		{Head: "S", Body: []grammarSymbol{"a", "A", "d"}},
+		{Head: "S", Body: []grammarSymbol{"b", "B", "d"}},
+		{Head: "S", Body: []grammarSymbol{"a", "B", "e"}},
+		{Head: "S", Body: []grammarSymbol{"b", "A", "e"}},
+		{Head: "A", Body: []grammarSymbol{"c"}},
+		{Head: "B", Body: []grammarSymbol{"c"}},
+	}
+	if _, err := g.compile(); err != nil {
+		t.Errorf("Expected LR(1) grammar to compile, got %v", err)
+	}
+
+	g.Mode = LALR1
+	_, err := g.compile()
+	expected := &ConflictError{[]Conflict{
+		{ReduceReduce, 6, "d", []int{5, 6}, []string{"A -> c .", "B -> c ."}, true},
+		{ReduceReduce, 6, "e", []int{5, 6}, []string{"A -> c .", "B -> c ."}, true},
+	}}
+	if !reflect.DeepEqual(err, expected) {
+		t.Errorf("Expected error %v, got %v", expected, err)
+	}
+}
+
+func TestCompileConflicts(t *testing.T) {
+	var g Grammar
+	g.Start = "expr'"
+	g.Productions = []Production{
+		{Head: "expr'", Body: []grammarSymbol{"expr"}},
+		{Head: "expr", Body: []grammarSymbol{"expr", "+", "expr"}},
+		{Head: "expr", Body: []grammarSymbol{"expr", "*", "expr"}},
+		{Head: "expr", Body: []grammarSymbol{"number"}},
+	}
+
+	_, err := g.compile()
+	conflictError, ok := err.(*ConflictError)
+	if !ok {
+		t.Fatalf("Expected a *ConflictError, got %v", err)
+	}
+	// Each of the two states reducing a binary expression conflicts with shifting both operators.
+	if len(conflictError.Conflicts) != 4 {
+		t.Errorf("Expected 4 conflicts, got %v", conflictError)
+	}
+	for _, c := range conflictError.Conflicts {
+		if c.Kind != ShiftReduce || c.IntroducedByMerge {
+			t.Errorf("Expected a shift-reduce conflict, got %v", c)
+		}
+	}
+	expected := Conflict{ShiftReduce, 5, "*", []int{2}, []string{"expr -> expr * expr .", "expr -> expr . * expr"}, false}
+	if !reflect.DeepEqual(conflictError.Conflicts[0], expected) {
+		t.Errorf("Expected first conflict %v, got %v", expected, conflictError.Conflicts[0])
+	}
+
+	g.Mode = "slr"
+	if _, err := g.compile(); err == nil {
+		t.Errorf("Expected an error for an unknown construction mode")
+	}
+}
+
+// formatTree writes the syntax graph below a node with parenthesis, like (+ 1 (* 2 3)). Attributes follow the
+// labels, like number[lexeme=2].
+func formatTree(ast SyntaxGraph, node int) string {
+	label := ast.NodeLabel[node]
+	if attributes := ast.NodeAttributes[node]; len(attributes) > 0 {
+		pairs := make([]string, 0, len(attributes))
+		for _, name := range sortedKeys(attributes) {
+			pairs = append(pairs, name+"="+attributes[name])
+		}
+		label += "[" + strings.Join(pairs, " ") + "]"
+	}
+	if len(ast.Graph[node]) == 0 {
+		return label
+	}
+	formatted := "(" + label
+	for _, child := range ast.Graph[node] {
+		formatted += " " + formatTree(ast, child)
+	}
+	return formatted + ")"
+}
+
+func TestCompilePrecedence(t *testing.T) {
+	var g Grammar
+	g.Start = "expr'"
+	g.Productions = []Production{
+		{Head: "expr'", Body: []grammarSymbol{"expr"}},
+		{Head: "expr", Body: []grammarSymbol{"expr", "+", "expr"}, Rule: SemanticRule{Type: "tree", RootLabel: "+", Children: []int{0, 2}}},
+		{Head: "expr", Body: []grammarSymbol{"expr", "-", "expr"}, Rule: SemanticRule{Type: "tree", RootLabel: "-", Children: []int{0, 2}}},
+		{Head: "expr", Body: []grammarSymbol{"expr", "*", "expr"}, Rule: SemanticRule{Type: "tree", RootLabel: "*", Children: []int{0, 2}}},
+		{Head: "expr", Body: []grammarSymbol{"expr", "^", "expr"}, Rule: SemanticRule{Type: "tree", RootLabel: "^", Children: []int{0, 2}}},
+		{Head: "expr", Body: []grammarSymbol{"expr", "<", "expr"}, Rule: SemanticRule{Type: "tree", RootLabel: "<", Children: []int{0, 2}}},
+		{Head: "expr", Body: []grammarSymbol{"number"}},
+	}
+	g.Precedence = []PrecedenceLevel{
+		{NonAssoc, []grammarSymbol{"<"}},
+		{Left, []grammarSymbol{"+", "-"}},
+		{Left, []grammarSymbol{"*"}},
+		{Right, []grammarSymbol{"^"}},
+	}
+
+	var testData = []struct {
+		input            string
+		expectedAccepted bool
+		expectedTree     string
+	}{
+		{"1 + 2 * 3", true, "(+ 1 (* 2 3))"},
+		{"1 * 2 + 3", true, "(+ (* 1 2) 3)"},
+		{"1 - 2 - 3", true, "(- (- 1 2) 3)"},
+		{"1 - 2 + 3", true, "(+ (- 1 2) 3)"},
+		{"2 ^ 3 ^ 2", true, "(^ 2 (^ 3 2))"},
+		{"1 + 2 < 3 * 4", true, "(< (+ 1 2) (* 3 4))"},
+		{"1 < 2 < 3", false, ""},
+	}
+
+	for _, mode := range []ConstructionMode{CanonicalLR1, LALR1} {
+		g.Mode = mode
+		ps, err := g.compile()
+		if err != nil {
+			t.Fatalf("Expected %v parser to compile, got %v", mode, err)
+		}
+		for _, test := range testData {
+			tokens := make([]lexer.Token, 0)
+			for _, lexeme := range strings.Fields(test.input) {
+				tokenType := lexeme
+				if lexeme[0] >= '0' && lexeme[0] <= '9' {
+					tokenType = "number"
+				}
+				tokens = append(tokens, lexer.Token{TokenType: tokenType, Lexeme: lexeme})
+			}
+			tokens = append(tokens, lexer.Token{TokenType: "$", Lexeme: "$"})
+
+			ast := ps.parse(tokens)
+			if ps.accepted != test.expectedAccepted {
+				t.Errorf("Expected %v parser to output %v on input %v, got %v", mode, test.expectedAccepted, test.input, ps.accepted)
+			}
+			if got := formatTree(ast, ps.gStack.top()); ps.accepted && got != test.expectedTree {
+				t.Errorf("Expected %v parser to build %v on input %v, got %v", mode, test.expectedTree, test.input, got)
+			}
+			ps.reset()
+		}
+	}
+}
+
+func TestCompileNullable(t *testing.T) {
+	var testData = []struct {
+		input            []grammarSymbol
+		expectedAccepted bool
+		expectedTree     string
+	}{
+		{[]grammarSymbol{"id", "(", ")"}, true, "(call id)"},
+		{[]grammarSymbol{"id", "(", "id", ")"}, true, "(call id id)"},
+		{[]grammarSymbol{"id", "(", "id", ",", "id", ")", "!"}, true, "(call id (args id id))"},
+		{[]grammarSymbol{"id", "(", ")", "!", "?"}, true, "(call id)"},
+		{[]grammarSymbol{"id", "(", ")", "?"}, true, "(call id)"},
+		{[]grammarSymbol{"id", "(", ")", "?", "!"}, false, ""},
+		{[]grammarSymbol{"id", "(", ")", "!", "!"}, false, ""},
+		{[]grammarSymbol{"id", "(", ",", ")"}, false, ""},
+	}
+
+	for _, mode := range []ConstructionMode{CanonicalLR1, LALR1} {
+		g := nullableGrammar
+		g.Mode = mode
+		ps, err := g.compile()
+		if err != nil {
+			t.Fatalf("Expected %v parser to compile, got %v", mode, err)
+		}
+		for _, test := range testData {
+			tokens := make([]lexer.Token, 0)
+			for _, tokenType := range test.input {
+				tokens = append(tokens, lexer.Token{TokenType: string(tokenType), Lexeme: string(tokenType)})
+			}
+			tokens = append(tokens, lexer.Token{TokenType: "$", Lexeme: "$"})
+
+			ast := ps.parse(tokens)
+			if ps.accepted != test.expectedAccepted {
+				t.Errorf("Expected %v parser to output %v on input %v, got %v", mode, test.expectedAccepted, test.input, ps.accepted)
+			}
+			if got := formatTree(ast, ps.gStack.top()); ps.accepted && got != test.expectedTree {
+				t.Errorf("Expected %v parser to build %v on input %v, got %v", mode, test.expectedTree, test.input, got)
+			}
+			ps.reset()
+		}
+	}
+}
+
+func TestCompileChildrenOrder(t *testing.T) {
+	var g Grammar
+	g.Start = "assign'"
+	g.Productions = []Production{
+		{Head: "assign'", Body: []grammarSymbol{"assign"}},
+		{Head: "assign", Body: []grammarSymbol{"id", "=", "number", ";"}, Rule: SemanticRule{Type: "tree", RootLabel: "=", Children: []int{2, 0}}},
+		{Head: "assign", Body: []grammarSymbol{"(", "assign", ")"}, Rule: SemanticRule{Type: "copy", Children: []int{1}}},
+	}
+
+	tokens := []lexer.Token{
+		{TokenType: "(", Lexeme: "("},
+		{TokenType: "id", Lexeme: "x"},
+		{TokenType: "=", Lexeme: "="},
+		{TokenType: "number", Lexeme: "1"},
+		{TokenType: ";", Lexeme: ";"},
+		{TokenType: ")", Lexeme: ")"},
+		{TokenType: "$", Lexeme: "$"},
+	}
+	ps, _ := g.compile()
+	ast := ps.parse(tokens)
+	if expected, got := "(= 1 x)", formatTree(ast, ps.gStack.top()); !ps.accepted || got != expected {
+		t.Errorf("Expected parser to build %v, got %v", expected, got)
 	}
-	g.compile() // It compiles without any conflicts
 }
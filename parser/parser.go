@@ -1,24 +1,276 @@
 package parser
 
-import "github.com/SaurabhJha/lexpar/lexer"
+import (
+	"fmt"
+	"strings"
+
+	"github.com/SaurabhJha/lexpar/lexer"
+)
 
 // Parser is the data structure used to export all the functionality that can be expected
 // from an LR parser
 type Parser struct {
-	p parser
+	p     parser
+	share bool
+}
+
+// Init of Parser sets up all the state required by the parser to start processing terminals. The grammar is
+// checked by Validate first, and if it has errors the returned error is a *ValidationError listing them. If the
+// grammar has conflicts, the returned error is a *ConflictError listing every one of them. Init does not know the
+// token types, so it cannot check that they include every terminal: InitWithTokenTypes does.
+func (P *Parser) Init(g Grammar) error {
+	return P.InitWithTokenTypes(g, nil)
+}
+
+// InitWithTokenTypes is Init which also passes tokenTypes to Validate, so that a terminal which is not one of the
+// token types is an error. A nil tokenTypes skips that check.
+func (P *Parser) InitWithTokenTypes(g Grammar, tokenTypes []string) error {
+	errors := make([]Diagnostic, 0)
+	for _, d := range g.Validate(tokenTypes) {
+		if d.Severity == SeverityError {
+			errors = append(errors, d)
+		}
+	}
+	if len(errors) > 0 {
+		return &ValidationError{errors}
+	}
+
+	p, err := g.compile()
+	if err != nil {
+		return err
+	}
+	P.p = p
+	return nil
+}
+
+// Tables is the parsing table built by Init written out as plain data, like code generators need. Grammar is the
+// grammar once EBNF bodies are rewritten, whose productions are numbered as in the table, and States[s] maps the
+// symbols with a move in state s to that move. State 0 is the start state.
+type Tables struct {
+	Grammar Grammar
+	States  []map[string]TableAction
+}
+
+// TableAction is a move of the parsing table. Type is "shift", "reduce" or "accept", and Number is the state to go
+// to on a shift, which is a goto for non terminals, or the production to reduce by.
+type TableAction struct {
+	Type   string
+	Number int
+}
+
+var actionTypeNames = map[parserActionType]string{shift: "shift", reduce: "reduce", accept: "accept"}
+
+// Tables returns the parsing table built by Init.
+func (P *Parser) Tables() Tables {
+	states := 0
+	for s := range P.p.table {
+		if int(s) >= states {
+			states = int(s) + 1
+		}
+	}
+	tables := Tables{P.p.g, make([]map[string]TableAction, states)}
+	for s := range tables.States {
+		tables.States[s] = make(map[string]TableAction)
+		for symbol, action := range P.p.table[state(s)] {
+			tables.States[s][string(symbol)] = TableAction{actionTypeNames[action.actionType], action.number}
+		}
+	}
+	return tables
+}
+
+// InitFromTables sets up the parser with a parsing table returned by Tables, without building it again. The grammar
+// of the tables is not checked, since it was checked when they were built, but an error is returned if a move goes
+// to a state or reduces by a production the tables do not have.
+func (P *Parser) InitFromTables(tables Tables) error {
+	actionTypes := make(map[string]parserActionType, len(actionTypeNames))
+	for actionType, name := range actionTypeNames {
+		actionTypes[name] = actionType
+	}
+	table := make(parsingTable)
+	for s, moves := range tables.States {
+		table[state(s)] = make(map[grammarSymbol]parserAction)
+		for symbol, move := range moves {
+			actionType, ok := actionTypes[move.Type]
+			if !ok {
+				return fmt.Errorf("unknown move %q on %v in state %v", move.Type, symbol, s)
+			}
+			if actionType == shift && (move.Number < 0 || move.Number >= len(tables.States)) ||
+				actionType == reduce && (move.Number < 0 || move.Number >= len(tables.Grammar.Productions)) {
+				return fmt.Errorf("%v move on %v in state %v has the number %v, which is out of range", move.Type, symbol, s, move.Number)
+			}
+			table[state(s)][grammarSymbol(symbol)] = parserAction{actionType, move.Number}
+		}
+	}
+	P.p.init(table, tables.Grammar)
+	return nil
+}
+
+// ParseError is a token which cannot come after the tokens before it. Expected lists the token types that could
+// have come instead, where "$" stands for the end of the input.
+type ParseError struct {
+	Token    lexer.Token
+	Expected []grammarSymbol
+}
+
+func (e *ParseError) Error() string {
+	expected := make([]string, len(e.Expected))
+	for i, s := range e.Expected {
+		expected[i] = describeTokenType(string(s))
+	}
+	return fmt.Sprintf("%d:%d: unexpected %v, expected %v",
+		e.Token.Start.Line, e.Token.Start.Column, describeToken(e.Token), strings.Join(expected, ", "))
+}
+
+// ParseErrors lists the syntax errors of an input, in the order they were found.
+type ParseErrors struct {
+	Errors []ParseError
+}
+
+func (e *ParseErrors) Error() string {
+	report := make([]string, len(e.Errors))
+	for i, parseError := range e.Errors {
+		report[i] = parseError.Error()
+	}
+	return strings.Join(report, "\n")
+}
+
+// As lets errors.As find the first syntax error of the input as a *ParseError, which is what Parse returned before
+// it went on to find more errors.
+func (e *ParseErrors) As(target interface{}) bool {
+	first, ok := target.(**ParseError)
+	if !ok || len(e.Errors) == 0 {
+		return false
+	}
+	*first = &e.Errors[0]
+	return true
+}
+
+func describeTokenType(tokenType string) string {
+	if tokenType == "$" {
+		return "end of input"
+	}
+	return tokenType
+}
+
+func describeToken(token lexer.Token) string {
+	if token.TokenType == "$" || token.TokenType == token.Lexeme {
+		return describeTokenType(token.TokenType)
+	}
+	return fmt.Sprintf("%v %q", token.TokenType, token.Lexeme)
+}
+
+// Parse takes as input a slice of tokens and parses them into the syntax graph built by the semantic rules of the
+// grammar. If the tokens are not a sentence of the grammar, the returned error is a *ParseErrors, from which
+// errors.As gets the first error as a *ParseError. The parser recovers from errors with the productions having the
+// "error" symbol in their body, and goes on to find more errors. If it cannot recover, the returned graph only
+// holds the nodes built so far and has no root.
+func (P *Parser) Parse(tokens []lexer.Token) (SyntaxGraph, error) {
+	P.p.mode = buildSyntaxGraph
+	P.p.share = P.share
+	err := P.run(tokens)
+	ast := P.p.ast
+	ast.Root = noNode
+	if P.p.accepted {
+		ast.Root = P.p.gStack.top()
+	}
+	return ast, err
+}
+
+// ParseConcrete parses tokens like Parse, but builds their concrete syntax tree instead of running the semantic
+// rules. The tree has a node per reduced production and per token, so its shape only depends on the grammar.
+func (P *Parser) ParseConcrete(tokens []lexer.Token) (ConcreteSyntaxTree, error) {
+	P.p.mode = buildConcreteTree
+	err := P.run(tokens)
+	cst := P.p.cst
+	cst.Root = noNode
+	if P.p.accepted {
+		cst.Root = P.p.gStack.top()
+	}
+	return cst, err
+}
+
+// Action computes the value of a production from the values of the symbols of its body, in body order. The value
+// of a terminal is its lexer.Token, including the tokens standing for the "error" symbol, and the value of a non
+// terminal is the one computed for it. An action can return any value, like a node of a typed syntax tree or the
+// result of evaluating an expression.
+type Action func(values []interface{}) interface{}
+
+// SetAction sets the action ParseValue runs on reducing the production of head with body. It has to be called
+// after Init. The productions of EBNF bodies are found by the bodies they are rewritten into, with helper non
+// terminals named like "args#1".
+func (P *Parser) SetAction(head string, body []string, action Action) error {
+	number, err := P.p.g.findProduction(head, body)
+	if err != nil {
+		return err
+	}
+	P.p.actions[number] = action
+	return nil
+}
+
+// ParseValue parses tokens like Parse, but computes a value per production with the actions set by SetAction
+// instead of running the semantic rules, and returns the value of the start symbol. A production without an
+// action takes the value of the node its semantic rule would build: the value of the child it copies, or a
+// []interface{} of the values of its children for "tree" and "append" rules. The value is nil if the parser could
+// not recover from a syntax error.
+func (P *Parser) ParseValue(tokens []lexer.Token) (interface{}, error) {
+	P.p.mode = computeValues
+	err := P.run(tokens)
+	if !P.p.accepted {
+		return nil, err
+	}
+	return P.p.values[P.p.gStack.top()], err
+}
+
+// DefineAttributes sets the attributes of the non terminals and the equations computing them, which
+// EvaluateAttributes uses. It has to be called after Init, and returns an error if the definition is not
+// L-attributed or if a production does not compute all the attributes it has to.
+func (P *Parser) DefineAttributes(attributes []Attribute, equations []AttributeEquation) error {
+	ag, err := newAttributeGrammar(P.p.g, attributes, equations)
+	if err != nil {
+		return err
+	}
+	P.p.attributes = ag
+	return nil
+}
+
+// EvaluateAttributes computes the attributes set by DefineAttributes for every node of a concrete syntax tree
+// built by ParseConcrete. An attribute is computed after the attributes it depends on, so the equations can be
+// given in any order, and the returned error names the attributes of a cycle if some depend on each other.
+func (P *Parser) EvaluateAttributes(cst ConcreteSyntaxTree) (AttributeValues, error) {
+	if cst.Root == noNode {
+		return nil, fmt.Errorf("the concrete syntax tree has no root")
+	}
+	ag := P.p.attributes
+	if ag == nil {
+		ag = &attributeGrammar{}
+	}
+	e := attributeEvaluator{ag: ag, cst: cst}
+	if err := e.evaluate(); err != nil {
+		return nil, err
+	}
+	return e.values, nil
 }
 
-// Init of Parser sets up all the state required by the parser to start processing terminals.
-func (P *Parser) Init(g Grammar) {
-	P.p = g.compile()
+// run parses tokens followed by the end of the input, and returns the syntax errors found.
+func (P *Parser) run(tokens []lexer.Token) error {
+	end := lexer.Position{Offset: 0, Line: 1, Column: 1}
+	if len(tokens) > 0 {
+		end = tokens[len(tokens)-1].End
+	}
+	tokens = append(tokens, lexer.Token{TokenType: "$", Lexeme: "$", Start: end, End: end})
+	P.p.parse(tokens)
+	if len(P.p.errs) > 0 {
+		return &ParseErrors{P.p.errs}
+	}
+	return nil
 }
 
-// Parse takes as input a slice of tokens and parses them.
-func (P *Parser) Parse(tokens []lexer.Token) SyntaxGraph {
-	tokens = append(tokens, lexer.Token{TokenType: "$", Lexeme: "$"})
-	ast := P.p.parse(tokens)
-	ast.Root = P.p.gStack.top()
-	return ast
+// ShareSubgraphs turns the sharing of equal subgraphs by Parse on or off. It is off by default, so that every node
+// keeps its own position. When it is on, the nodes built by "tree" rules with the same label, children and
+// attributes, and the leaves of tokens with the same type and lexeme, are the same node. A shared node keeps the
+// position where it was first built. The setting is kept by Init and InitFromTables.
+func (P *Parser) ShareSubgraphs(share bool) {
+	P.share = share
 }
 
 // Reset resets parser state back to its initial state where it can parse more tokens.
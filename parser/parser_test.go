@@ -0,0 +1,544 @@
+package parser
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/SaurabhJha/lexpar/lexer"
+)
+
+func TestParse(t *testing.T) {
+	var testData = []struct {
+		input            []grammarSymbol
+		expectedTree     string
+		expectedToken    int
+		expectedExpected []grammarSymbol
+	}{
+		{[]grammarSymbol{"id", "(", "id", ")", "!"}, "(call id id)", -1, nil},
+		{[]grammarSymbol{"id", "(", ",", ")"}, "", 2, []grammarSymbol{")", "id"}},
+		{[]grammarSymbol{"id", "(", ")", "?", "!"}, "", 4, []grammarSymbol{"$"}},
+		{[]grammarSymbol{"id", "(", "id"}, "", 3, []grammarSymbol{")", ","}},
+		{[]grammarSymbol{}, "", 0, []grammarSymbol{"id"}},
+	}
+
+	for _, mode := range []ConstructionMode{CanonicalLR1, LALR1} {
+		g := nullableGrammar
+		g.Mode = mode
+		var P Parser
+		if err := P.Init(g); err != nil {
+			t.Fatalf("Expected %v parser to compile, got %v", mode, err)
+		}
+		for _, test := range testData {
+			tokens := make([]lexer.Token, 0)
+			for i, tokenType := range test.input {
+				position := lexer.Position{Offset: i, Line: 1, Column: i + 1}
+				tokens = append(tokens, lexer.Token{TokenType: string(tokenType), Lexeme: string(tokenType), Start: position, End: position})
+			}
+
+			ast, err := P.Parse(tokens)
+			if test.expectedToken < 0 {
+				if err != nil {
+					t.Errorf("Expected %v parser to accept %v, got %v", mode, test.input, err)
+				} else if got := formatTree(ast, ast.Root); got != test.expectedTree {
+					t.Errorf("Expected %v parser to build %v on input %v, got %v", mode, test.expectedTree, test.input, got)
+				}
+				P.Reset()
+				continue
+			}
+
+			parseErrors, ok := err.(*ParseErrors)
+			if !ok || len(parseErrors.Errors) != 1 {
+				t.Errorf("Expected %v parser to return a single error on input %v, got %v", mode, test.input, err)
+				P.Reset()
+				continue
+			}
+			parseError := parseErrors.Errors[0]
+			if ast.Root != noNode {
+				t.Errorf("Expected no root on input %v, got %v", test.input, ast.Root)
+			}
+			expectedType := "$"
+			if test.expectedToken < len(test.input) {
+				expectedType = string(test.input[test.expectedToken])
+			}
+			if parseError.Token.TokenType != expectedType {
+				t.Errorf("Expected %v parser to fail on %v in input %v, got %v", mode, expectedType, test.input, parseError.Token.TokenType)
+			}
+			if !reflect.DeepEqual(parseError.Expected, test.expectedExpected) {
+				t.Errorf("Expected %v parser to expect %v in input %v, got %v", mode, test.expectedExpected, test.input, parseError.Expected)
+			}
+			P.Reset()
+		}
+	}
+}
+
+// statementsGrammar is a grammar for a list of assignments which recovers from errors at the next ";".
+var statementsGrammar = Grammar{
+	Start: "prog'",
+	Productions: []Production{
+		{Head: "prog'", Body: []grammarSymbol{"prog"}},
+		{Head: "prog", Body: []grammarSymbol{"prog", "stmt"}, Rule: SemanticRule{Type: "tree", RootLabel: "seq", Children: []int{0, 1}}},
+		{Head: "prog", Body: []grammarSymbol{"stmt"}},
+		{Head: "stmt", Body: []grammarSymbol{"id", "=", "expr", ";"}, Rule: SemanticRule{Type: "tree", RootLabel: "=", Children: []int{0, 2}}},
+		{Head: "stmt", Body: []grammarSymbol{"error", ";"}},
+		{Head: "expr", Body: []grammarSymbol{"expr", "+", "id"}, Rule: SemanticRule{Type: "tree", RootLabel: "+", Children: []int{0, 2}}},
+		{Head: "expr", Body: []grammarSymbol{"id"}},
+	},
+}
+
+func TestParseRecovery(t *testing.T) {
+	var testData = []struct {
+		input           string
+		expectedTree    string
+		expectedColumns []int
+	}{
+		{"id = id ; id = id + id ;", "(seq (= id id) (= id (+ id id)))", nil},
+		{"id = + id ; id = id ;", "(seq error (= id id))", []int{3}},
+		{"id id ; id = = id ; id = id ;", "(seq (seq error error) (= id id))", []int{2, 6}},
+		// The second error comes before the parser is back in sync, so it is not reported.
+		{"id = ; id ; id = id ;", "(seq (seq error error) (= id id))", []int{3}},
+		// The end of the input is where the last token ends.
+		{"id = id", "", []int{3}},
+		// Without tokens, the end of the input is at the start of the first line.
+		{"", "", []int{1}},
+	}
+
+	for _, mode := range []ConstructionMode{CanonicalLR1, LALR1} {
+		g := statementsGrammar
+		g.Mode = mode
+		var P Parser
+		if err := P.Init(g); err != nil {
+			t.Fatalf("Expected %v parser to compile, got %v", mode, err)
+		}
+		for _, test := range testData {
+			tokens := make([]lexer.Token, 0)
+			for i, tokenType := range strings.Fields(test.input) {
+				position := lexer.Position{Offset: i, Line: 1, Column: i + 1}
+				tokens = append(tokens, lexer.Token{TokenType: tokenType, Lexeme: tokenType, Start: position, End: position})
+			}
+
+			ast, err := P.Parse(tokens)
+			var columns []int
+			if parseErrors, ok := err.(*ParseErrors); ok {
+				for _, parseError := range parseErrors.Errors {
+					columns = append(columns, parseError.Token.Start.Column)
+				}
+			} else if err != nil {
+				t.Errorf("Expected %v parser to return a *ParseErrors on input %v, got %v", mode, test.input, err)
+			}
+			if !reflect.DeepEqual(columns, test.expectedColumns) {
+				t.Errorf("Expected %v parser to find errors at %v on input %v, got %v", mode, test.expectedColumns, test.input, columns)
+			}
+			got := ""
+			if ast.Root != noNode {
+				got = formatTree(ast, ast.Root)
+			}
+			if got != test.expectedTree {
+				t.Errorf("Expected %v parser to build %v on input %v, got %v", mode, test.expectedTree, test.input, got)
+			}
+			P.Reset()
+		}
+	}
+}
+
+func TestParseNodeEnds(t *testing.T) {
+	var P Parser
+	if err := P.Init(statementsGrammar); err != nil {
+		t.Fatalf("Expected parser to compile, got %v", err)
+	}
+	tokens := make([]lexer.Token, 0)
+	for i, tokenType := range strings.Fields("id = id + id ;") {
+		start, end := lexer.Position{Offset: i, Line: 1, Column: i + 1}, lexer.Position{Offset: i + 1, Line: 1, Column: i + 2}
+		tokens = append(tokens, lexer.Token{TokenType: tokenType, Lexeme: tokenType, Start: start, End: end})
+	}
+	ast, err := P.Parse(tokens)
+	if err != nil {
+		t.Fatalf("Expected input to be parsed, got %v", err)
+	}
+
+	// The statement ends with the ; which is not one of its children.
+	var testData = []struct {
+		node           int
+		expectedLabel  string
+		expectedColumn int
+	}{
+		{ast.Root, "=", 7},
+		{ast.Graph[ast.Root][1], "+", 6},
+		{ast.Graph[ast.Root][0], "id", 2},
+	}
+	for _, test := range testData {
+		if ast.NodeLabel[test.node] != test.expectedLabel || ast.NodeEnd[test.node].Column != test.expectedColumn {
+			t.Errorf("Expected %v to end at column %v, got %v ending at column %v", test.expectedLabel,
+				test.expectedColumn, ast.NodeLabel[test.node], ast.NodeEnd[test.node].Column)
+		}
+	}
+}
+
+func TestParseErrorMessage(t *testing.T) {
+	var testData = []struct {
+		err             ParseError
+		expectedMessage string
+	}{
+		{
+			ParseError{lexer.Token{TokenType: "+", Lexeme: "+", Start: lexer.Position{Offset: 4, Line: 1, Column: 5}}, []grammarSymbol{"(", "id", "number"}},
+			"1:5: unexpected +, expected (, id, number",
+		},
+		{
+			ParseError{lexer.Token{TokenType: "number", Lexeme: "42", Start: lexer.Position{Offset: 9, Line: 2, Column: 3}}, []grammarSymbol{"$", ")"}},
+			"2:3: unexpected number \"42\", expected end of input, )",
+		},
+		{
+			ParseError{lexer.Token{TokenType: "$", Lexeme: "$", Start: lexer.Position{Offset: 3, Line: 1, Column: 4}}, []grammarSymbol{"id"}},
+			"1:4: unexpected end of input, expected id",
+		},
+	}
+
+	for _, test := range testData {
+		if got := test.err.Error(); got != test.expectedMessage {
+			t.Errorf("Expected %q, got %q", test.expectedMessage, got)
+		}
+	}
+
+	parseErrors := ParseErrors{[]ParseError{testData[0].err, testData[1].err}}
+	expectedMessage := testData[0].expectedMessage + "\n" + testData[1].expectedMessage
+	if got := parseErrors.Error(); got != expectedMessage {
+		t.Errorf("Expected %q, got %q", expectedMessage, got)
+	}
+
+	var err error = fmt.Errorf("parsing: %w", &parseErrors)
+	var first *ParseError
+	if !errors.As(err, &first) || first.Error() != testData[0].expectedMessage {
+		t.Errorf("Expected errors.As to find %q, got %v", testData[0].expectedMessage, first)
+	}
+	if errors.As(&ParseErrors{}, &first) {
+		t.Errorf("Expected errors.As to find no *ParseError without errors")
+	}
+}
+
+// formatConcreteTree writes a concrete syntax tree like formatTree, with leaves written as their token types.
+func formatConcreteTree(cst ConcreteSyntaxTree, node int) string {
+	if cst.Nodes[node].Production < 0 {
+		return cst.Nodes[node].Symbol
+	}
+	formatted := "(" + cst.Nodes[node].Symbol
+	for _, child := range cst.Nodes[node].Children {
+		formatted += " " + formatConcreteTree(cst, child)
+	}
+	return formatted + ")"
+}
+
+func TestParseConcrete(t *testing.T) {
+	var testData = []struct {
+		input         []grammarSymbol
+		expectedTree  string
+		expectedStart int
+		expectedEnd   int
+	}{
+		{[]grammarSymbol{"id", "(", ")"}, "(call' (call id ( (args) ) (params (bang) (question))))", 1, 4},
+		{[]grammarSymbol{"id", "(", "id", ",", "id", ")", "!"}, "(call' (call id ( (args (arglist (arglist id) , id)) ) (params (bang !) (question))))", 1, 8},
+	}
+
+	var P Parser
+	if err := P.Init(nullableGrammar); err != nil {
+		t.Fatalf("Expected parser to compile, got %v", err)
+	}
+	for _, test := range testData {
+		tokens := make([]lexer.Token, 0)
+		for i, tokenType := range test.input {
+			tokens = append(tokens, lexer.Token{
+				TokenType: string(tokenType),
+				Lexeme:    string(tokenType),
+				Start:     lexer.Position{Offset: i, Line: 1, Column: i + 1},
+				End:       lexer.Position{Offset: i + 1, Line: 1, Column: i + 2},
+			})
+		}
+
+		cst, err := P.ParseConcrete(tokens)
+		if err != nil {
+			t.Errorf("Expected %v to be parsed, got %v", test.input, err)
+		} else if got := formatConcreteTree(cst, cst.Root); got != test.expectedTree {
+			t.Errorf("Expected %v on input %v, got %v", test.expectedTree, test.input, got)
+		} else if root := cst.Nodes[cst.Root]; root.Start.Column != test.expectedStart || root.End.Column != test.expectedEnd {
+			t.Errorf("Expected root to span columns %v to %v on input %v, got %v to %v", test.expectedStart, test.expectedEnd, test.input, root.Start.Column, root.End.Column)
+		} else if root.Production != 0 {
+			t.Errorf("Expected root to be production 0, got %v", root.Production)
+		}
+		P.Reset()
+	}
+}
+
+func TestParseShareSubgraphs(t *testing.T) {
+	var g Grammar
+	g.Start = "expr'"
+	g.Productions = []Production{
+		{Head: "expr'", Body: []grammarSymbol{"expr"}},
+		{Head: "expr", Body: []grammarSymbol{"expr", "+", "term"}, Rule: SemanticRule{Type: "tree", RootLabel: "+", Children: []int{0, 2}}},
+		{Head: "expr", Body: []grammarSymbol{"term"}},
+		{Head: "term", Body: []grammarSymbol{"(", "expr", ")"}, Rule: SemanticRule{Type: "copy", Children: []int{1}}},
+		{Head: "term", Body: []grammarSymbol{"[", "list", "]"}, Rule: SemanticRule{Type: "copy", Children: []int{1}}},
+		{Head: "term", Body: []grammarSymbol{"id"}},
+		{Head: "list", EBNF: "term*"},
+	}
+	var testData = []struct {
+		input                string
+		expectedTree         string
+		expectedSharedNodes  int
+		expectedPrivateNodes int
+	}{
+		{"id + id", "(+ id id)", 3, 4},
+		{"( id + id ) + ( id + id )", "(+ (+ id id) (+ id id))", 6, 14},
+		// Lists grow after they are built, so they are never shared.
+		{"[ ] + [ id ] + [ id ]", "(+ (+ list (list id)) (list id))", 9, 15},
+	}
+
+	var P Parser
+	if err := P.Init(g); err != nil {
+		t.Fatalf("Expected parser to compile, got %v", err)
+	}
+	// Sharing is off by default, so that every node keeps its own position.
+	ast, _ := P.Parse([]lexer.Token{{TokenType: "id", Lexeme: "a"}, {TokenType: "+", Lexeme: "+"}, {TokenType: "id", Lexeme: "a"}})
+	if len(ast.NodeLabel) != 4 {
+		t.Errorf("Expected 4 nodes without sharing, got %v", len(ast.NodeLabel))
+	}
+	P.Reset()
+
+	// Leaves of tokens with the same lexeme are only shared if the tokens have the same type.
+	P.ShareSubgraphs(true)
+	ast, _ = P.Parse([]lexer.Token{{TokenType: "id", Lexeme: "a"}, {TokenType: "+", Lexeme: "+"}, {TokenType: "id", Lexeme: "+"}})
+	if len(ast.NodeLabel) != 4 {
+		t.Errorf("Expected 4 nodes when an id has the lexeme +, got %v", len(ast.NodeLabel))
+	}
+	P.Reset()
+
+	for _, share := range []bool{true, false} {
+		P.ShareSubgraphs(share)
+		for _, test := range testData {
+			tokens := make([]lexer.Token, 0)
+			for _, tokenType := range strings.Fields(test.input) {
+				tokens = append(tokens, lexer.Token{TokenType: tokenType, Lexeme: tokenType})
+			}
+
+			ast, err := P.Parse(tokens)
+			expectedNodes := test.expectedPrivateNodes
+			if share {
+				expectedNodes = test.expectedSharedNodes
+			}
+			if err != nil {
+				t.Errorf("Expected %v to be parsed, got %v", test.input, err)
+			} else if got := formatTree(ast, ast.Root); got != test.expectedTree {
+				t.Errorf("Expected %v on input %v, got %v", test.expectedTree, test.input, got)
+			} else if len(ast.NodeLabel) != expectedNodes {
+				t.Errorf("Expected %v nodes on input %v with sharing set to %v, got %v", expectedNodes, test.input, share, len(ast.NodeLabel))
+			}
+			P.Reset()
+		}
+	}
+
+	// Initialising the parser again keeps sharing on.
+	P.ShareSubgraphs(true)
+	if err := P.Init(g); err != nil {
+		t.Fatalf("Expected parser to compile, got %v", err)
+	}
+	ast, _ = P.Parse([]lexer.Token{{TokenType: "id", Lexeme: "a"}, {TokenType: "+", Lexeme: "+"}, {TokenType: "id", Lexeme: "a"}})
+	if len(ast.NodeLabel) != 3 {
+		t.Errorf("Expected 3 nodes with sharing kept by Init, got %v", len(ast.NodeLabel))
+	}
+}
+
+func TestParseSemanticRules(t *testing.T) {
+	var g Grammar
+	g.Start = "stmts'"
+	g.Productions = []Production{
+		{Head: "stmts'", Body: []grammarSymbol{"stmts"}},
+		{Head: "stmts", Body: []grammarSymbol{"stmt"}, Rule: SemanticRule{Type: "tree", RootLabel: "stmts", Children: []int{0}}},
+		{Head: "stmts", Body: []grammarSymbol{"stmts", ";", "stmt"}, Rule: SemanticRule{Type: "append", Children: []int{0, 2}}},
+		{Head: "stmt", Body: []grammarSymbol{"id", "op", "expr"}, Rule: SemanticRule{Type: "tree", RootLabel: "$1", Children: []int{2}, Attributes: map[string]string{"target": "$0"}}},
+		{Head: "expr", Body: []grammarSymbol{"number"}, Rule: SemanticRule{Type: "leaf", RootLabel: "number", Children: []int{0}, Attributes: map[string]string{"base": "10"}}},
+		{Head: "expr", Body: []grammarSymbol{"id"}, Rule: SemanticRule{Type: "leaf", RootLabel: "name", Children: []int{0}}},
+	}
+	var testData = []struct {
+		input        string
+		expectedTree string
+	}{
+		{"x = 12", "(stmts (=[target=x] number[base=10 lexeme=12]))"},
+		{"x = 12 ; y += x ; z = 12", "(stmts (=[target=x] number[base=10 lexeme=12]) (+=[target=y] name[lexeme=x]) (=[target=z] number[base=10 lexeme=12]))"},
+	}
+
+	var P Parser
+	if err := P.Init(g); err != nil {
+		t.Fatalf("Expected parser to compile, got %v", err)
+	}
+	for _, test := range testData {
+		tokens := make([]lexer.Token, 0)
+		for _, lexeme := range strings.Fields(test.input) {
+			tokenType := lexeme
+			switch {
+			case strings.HasSuffix(lexeme, "="):
+				tokenType = "op"
+			case lexeme[0] >= '0' && lexeme[0] <= '9':
+				tokenType = "number"
+			case lexeme != ";":
+				tokenType = "id"
+			}
+			tokens = append(tokens, lexer.Token{TokenType: tokenType, Lexeme: lexeme})
+		}
+
+		ast, err := P.Parse(tokens)
+		if err != nil {
+			t.Errorf("Expected %v to be parsed, got %v", test.input, err)
+		} else if got := formatTree(ast, ast.Root); got != test.expectedTree {
+			t.Errorf("Expected %v on input %v, got %v", test.expectedTree, test.input, got)
+		}
+		P.Reset()
+	}
+}
+
+func TestParseValue(t *testing.T) {
+	var g Grammar
+	g.Start = "expr'"
+	g.Productions = []Production{
+		{Head: "expr'", Body: []grammarSymbol{"expr"}},
+		{Head: "expr", Body: []grammarSymbol{"expr", "+", "term"}, Rule: SemanticRule{Type: "tree", RootLabel: "+", Children: []int{0, 2}}},
+		{Head: "expr", Body: []grammarSymbol{"term"}},
+		{Head: "term", Body: []grammarSymbol{"(", "expr", ")"}, Rule: SemanticRule{Type: "copy", Children: []int{1}}},
+		{Head: "term", Body: []grammarSymbol{"[", "list", "]"}, Rule: SemanticRule{Type: "copy", Children: []int{1}}},
+		{Head: "term", Body: []grammarSymbol{"number"}},
+		{Head: "list", EBNF: "term*"},
+	}
+	var testData = []struct {
+		input         string
+		expectedValue int
+	}{
+		{"1", 1},
+		{"1 + 2", 3},
+		{"( 1 + 2 ) + 40", 43},
+		{"[ 1 2 3 ] + 1", 4},
+		{"[ ] + 5", 5},
+		{"[ [ 1 ] ( 2 ) ]", 2},
+	}
+
+	var P Parser
+	if err := P.Init(g); err != nil {
+		t.Fatalf("Expected parser to compile, got %v", err)
+	}
+	P.SetAction("expr", []string{"expr", "+", "term"}, func(values []interface{}) interface{} {
+		return values[0].(int) + values[2].(int)
+	})
+	P.SetAction("term", []string{"number"}, func(values []interface{}) interface{} {
+		n, _ := strconv.Atoi(values[0].(lexer.Token).Lexeme)
+		return n
+	})
+	// Without an action, the repetition in list has a slice of the values of the terms.
+	P.SetAction("term", []string{"[", "list", "]"}, func(values []interface{}) interface{} {
+		return len(values[1].([]interface{}))
+	})
+	if err := P.SetAction("term", []string{"[", "]"}, nil); err == nil || err.Error() != "grammar has no production term -> [ ]" {
+		t.Errorf("Expected an error for a production which is not in the grammar, got %v", err)
+	}
+
+	for _, test := range testData {
+		tokens := make([]lexer.Token, 0)
+		for _, lexeme := range strings.Fields(test.input) {
+			tokenType := lexeme
+			if lexeme[0] >= '0' && lexeme[0] <= '9' {
+				tokenType = "number"
+			}
+			tokens = append(tokens, lexer.Token{TokenType: tokenType, Lexeme: lexeme})
+		}
+
+		value, err := P.ParseValue(tokens)
+		if err != nil {
+			t.Errorf("Expected %v to be parsed, got %v", test.input, err)
+		} else if value != test.expectedValue {
+			t.Errorf("Expected %v on input %v, got %v", test.expectedValue, test.input, value)
+		}
+		P.Reset()
+	}
+
+	// Productions without an action take the value of the nodes their rules would build.
+	var Q Parser
+	Q.Init(g)
+	one := lexer.Token{TokenType: "number", Lexeme: "1"}
+	value, err := Q.ParseValue([]lexer.Token{one, {TokenType: "+", Lexeme: "+"}, {TokenType: "[", Lexeme: "["}, one, {TokenType: "]", Lexeme: "]"}})
+	expectedValue := []interface{}{one, []interface{}{one}}
+	if err != nil || !reflect.DeepEqual(value, expectedValue) {
+		t.Errorf("Expected %v, got %v and %v", expectedValue, value, err)
+	}
+}
+
+func TestParserTables(t *testing.T) {
+	var P Parser
+	if err := P.Init(statementsGrammar); err != nil {
+		t.Fatalf("Expected parser to compile, got %v", err)
+	}
+	tables := P.Tables()
+	if !reflect.DeepEqual(tables.Grammar, P.p.g) {
+		t.Errorf("Expected the tables to have the grammar of the parser, got %+v", tables.Grammar)
+	}
+
+	entries, accepts := 0, 0
+	for s, moves := range tables.States {
+		for symbol, move := range moves {
+			entries++
+			expected := P.p.table[state(s)][grammarSymbol(symbol)]
+			if move.Type != actionTypeNames[expected.actionType] || move.Number != expected.number {
+				t.Errorf("Expected move %v on %v in state %v, got %v", expected, symbol, s, move)
+			}
+			if move.Type == "accept" {
+				accepts++
+			}
+		}
+	}
+	tableEntries := 0
+	for _, moves := range P.p.table {
+		tableEntries += len(moves)
+	}
+	if entries != tableEntries || accepts != 1 {
+		t.Errorf("Expected %v moves with one accept, got %v moves with %v accepts", tableEntries, entries, accepts)
+	}
+}
+
+func TestParserInitFromTables(t *testing.T) {
+	var built Parser
+	if err := built.Init(statementsGrammar); err != nil {
+		t.Fatalf("Expected parser to compile, got %v", err)
+	}
+	var loaded Parser
+	if err := loaded.InitFromTables(built.Tables()); err != nil {
+		t.Fatalf("Expected tables to be loaded, got %v", err)
+	}
+	if !reflect.DeepEqual(loaded.Tables(), built.Tables()) {
+		t.Errorf("Expected the loaded parser to have the tables %v, got %v", built.Tables(), loaded.Tables())
+	}
+
+	tokens := make([]lexer.Token, 0)
+	for _, tokenType := range strings.Fields("id = id ; id id ; id = ( id ) ;") {
+		tokens = append(tokens, lexer.Token{TokenType: tokenType, Lexeme: tokenType})
+	}
+	expectedTree, expectedErr := built.Parse(tokens)
+	tree, err := loaded.Parse(tokens)
+	if !reflect.DeepEqual(tree, expectedTree) || !reflect.DeepEqual(err, expectedErr) {
+		t.Errorf("Expected %v and %v, got %v and %v", expectedTree, expectedErr, tree, err)
+	}
+
+	tables := built.Tables()
+	var testData = []struct {
+		move          TableAction
+		expectedError string
+	}{
+		{TableAction{"jump", 1}, "unknown move \"jump\" on id in state 0"},
+		{TableAction{"shift", len(tables.States)}, fmt.Sprintf("shift move on id in state 0 has the number %v, which is out of range", len(tables.States))},
+		{TableAction{"shift", -1}, "shift move on id in state 0 has the number -1, which is out of range"},
+		{TableAction{"reduce", len(tables.Grammar.Productions)}, fmt.Sprintf("reduce move on id in state 0 has the number %v, which is out of range", len(tables.Grammar.Productions))},
+	}
+	for _, test := range testData {
+		tables = built.Tables()
+		tables.States[0] = map[string]TableAction{"id": test.move}
+		if err := loaded.InitFromTables(tables); err == nil || err.Error() != test.expectedError {
+			t.Errorf("Expected the error %q for the move %v, got %v", test.expectedError, test.move, err)
+		}
+	}
+}
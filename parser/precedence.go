@@ -0,0 +1,92 @@
+package parser
+
+import "fmt"
+
+// Associativity tells how operators of the same precedence group, like %left, %right and %nonassoc in yacc.
+type Associativity string
+
+const (
+	// Left makes a - b - c parse as (a - b) - c.
+	Left Associativity = "left"
+	// Right makes a = b = c parse as a = (b = c).
+	Right Associativity = "right"
+	// NonAssoc makes a < b < c a syntax error.
+	NonAssoc Associativity = "nonassoc"
+)
+
+// PrecedenceLevel gives the same precedence and associativity to some terminals. Terminals that only appear in
+// precedence levels, like a UMINUS used to override the precedence of a production, are allowed.
+type PrecedenceLevel struct {
+	Associativity Associativity
+	Terminals     []grammarSymbol
+}
+
+// resolution is what the precedence declarations say about a shift-reduce conflict.
+type resolution int
+
+const (
+	unresolved resolution = iota
+	resolveShift
+	resolveReduce
+	resolveError
+)
+
+// indexPrecedence numbers the precedence levels from 1 so that 0 can stand for no precedence.
+func (gi *grammarIndex) indexPrecedence() error {
+	gi.precedenceOf = make(map[grammarSymbol]int)
+	gi.associativityOf = make(map[grammarSymbol]Associativity)
+	for i, level := range gi.g.Precedence {
+		switch level.Associativity {
+		case Left, Right, NonAssoc:
+		default:
+			return fmt.Errorf("unknown associativity %q in precedence level %v", level.Associativity, i)
+		}
+		for _, s := range level.Terminals {
+			if _, ok := gi.precedenceOf[s]; ok {
+				return fmt.Errorf("precedence of %v is declared more than once", s)
+			}
+			gi.precedenceOf[s] = i + 1
+			gi.associativityOf[s] = level.Associativity
+		}
+	}
+	return nil
+}
+
+// getProductionPrecedence returns the precedence of the production's Precedence symbol if it has one. Otherwise,
+// like yacc, it is the precedence of the last terminal in the body that has a precedence.
+func (gi *grammarIndex) getProductionPrecedence(p int) int {
+	production := gi.g.Productions[p]
+	if production.Precedence != "" {
+		return gi.precedenceOf[production.Precedence]
+	}
+	for i := len(production.Body) - 1; i >= 0; i-- {
+		if s := production.Body[i]; gi.isTerminal(s) && gi.precedenceOf[s] > 0 {
+			return gi.precedenceOf[s]
+		}
+	}
+	return 0
+}
+
+// resolveShiftReduce settles a conflict between shifting a symbol and reducing by a production. The one with the
+// higher precedence wins, and ties are broken by the associativity of the symbol.
+func (gi *grammarIndex) resolveShiftReduce(p int, symbol grammarSymbol) resolution {
+	productionPrecedence := gi.getProductionPrecedence(p)
+	symbolPrecedence := gi.precedenceOf[symbol]
+	switch {
+	case productionPrecedence == 0 || symbolPrecedence == 0:
+		return unresolved
+	case productionPrecedence > symbolPrecedence:
+		return resolveReduce
+	case productionPrecedence < symbolPrecedence:
+		return resolveShift
+	}
+
+	switch gi.associativityOf[symbol] {
+	case Left:
+		return resolveReduce
+	case Right:
+		return resolveShift
+	default:
+		return resolveError
+	}
+}
@@ -0,0 +1,70 @@
+package parser
+
+import "testing"
+
+func TestResolveShiftReduce(t *testing.T) {
+	var g Grammar
+	g.Start = "expr'"
+	g.Productions = []Production{
+		{Head: "expr'", Body: []grammarSymbol{"expr"}},
+		{Head: "expr", Body: []grammarSymbol{"expr", "+", "expr"}},
+		{Head: "expr", Body: []grammarSymbol{"expr", "*", "expr"}},
+		{Head: "expr", Body: []grammarSymbol{"expr", "^", "expr"}},
+		{Head: "expr", Body: []grammarSymbol{"expr", "<", "expr"}},
+		{Head: "expr", Body: []grammarSymbol{"-", "expr"}, Precedence: "UMINUS"},
+		{Head: "expr", Body: []grammarSymbol{"(", "expr", ")"}},
+		{Head: "expr", Body: []grammarSymbol{"number"}},
+	}
+	g.Precedence = []PrecedenceLevel{
+		{NonAssoc, []grammarSymbol{"<"}},
+		{Left, []grammarSymbol{"+"}},
+		{Left, []grammarSymbol{"*"}},
+		{Right, []grammarSymbol{"^"}},
+		{Right, []grammarSymbol{"UMINUS"}},
+	}
+	gi := g.index()
+	if err := gi.indexPrecedence(); err != nil {
+		t.Fatalf("Expected precedence to be valid, got %v", err)
+	}
+
+	var testData = []struct {
+		production int
+		symbol     grammarSymbol
+		expected   resolution
+	}{
+		{1, "+", resolveReduce},
+		{1, "*", resolveShift},
+		{2, "+", resolveReduce},
+		{3, "^", resolveShift},
+		{4, "<", resolveError},
+		{4, "+", resolveShift},
+		{5, "*", resolveReduce},
+		{5, "^", resolveReduce},
+		{1, ")", unresolved},
+		{6, "+", unresolved},
+		{7, "+", unresolved},
+	}
+
+	for _, test := range testData {
+		if got := gi.resolveShiftReduce(test.production, test.symbol); got != test.expected {
+			t.Errorf("Expected resolveShiftReduce(%v, %v) = %v, got %v", test.production, test.symbol, test.expected, got)
+		}
+	}
+}
+
+func TestIndexPrecedenceErrors(t *testing.T) {
+	var testData = []struct {
+		precedence []PrecedenceLevel
+		expected   string
+	}{
+		{[]PrecedenceLevel{{"middle", []grammarSymbol{"+"}}}, "unknown associativity \"middle\" in precedence level 0"},
+		{[]PrecedenceLevel{{Left, []grammarSymbol{"+"}}, {Right, []grammarSymbol{"+"}}}, "precedence of + is declared more than once"},
+	}
+
+	for _, test := range testData {
+		gi := Grammar{Precedence: test.precedence}.index()
+		if err := gi.indexPrecedence(); err == nil || err.Error() != test.expected {
+			t.Errorf("Expected error %q, got %v", test.expected, err)
+		}
+	}
+}
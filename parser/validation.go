@@ -0,0 +1,223 @@
+package parser
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Severity tells whether a diagnostic stops the grammar from being used.
+type Severity string
+
+const (
+	// SeverityError is for mistakes which make the grammar unusable, or which would make the parser fail.
+	SeverityError Severity = "error"
+	// SeverityWarning is for parts of the grammar which are useless but harmless.
+	SeverityWarning Severity = "warning"
+)
+
+// Diagnostic is a problem found in a grammar by Validate. Production is the number of the production it is about,
+// or -1, and Symbol is the symbol it is about, if any.
+type Diagnostic struct {
+	Severity   Severity
+	Production int
+	Symbol     grammarSymbol
+	Message    string
+}
+
+func (d Diagnostic) String() string {
+	return fmt.Sprintf("%v: %v", d.Severity, d.Message)
+}
+
+// ValidationError lists the errors found in a grammar by Validate.
+type ValidationError struct {
+	Diagnostics []Diagnostic
+}
+
+func (e *ValidationError) Error() string {
+	report := make([]string, 0, len(e.Diagnostics)+1)
+	report = append(report, fmt.Sprintf("grammar has %v errors", len(e.Diagnostics)))
+	for _, d := range e.Diagnostics {
+		report = append(report, d.String())
+	}
+	return strings.Join(report, "\n")
+}
+
+// knownRuleTypes are the types of semantic rules the parser can run, along with whether they need children.
+var knownRuleTypes = map[string]bool{
+	"":       false,
+	"tree":   false,
+	"leaf":   true,
+	"copy":   true,
+	"append": true,
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func formatProduction(p Production) string {
+	var b strings.Builder
+	b.WriteString(string(p.Head))
+	b.WriteString(" ->")
+	for _, s := range p.Body {
+		b.WriteByte(' ')
+		b.WriteString(string(s))
+	}
+	return b.String()
+}
+
+// Validate checks the grammar and returns what is wrong with it, in the order of the productions. It checks that
+// the start symbol has exactly one production and appears in no body, that every non terminal can be reached from the start symbol and
+// derives some string of terminals, and that the children of semantic rules are in their bodies. If tokenTypes is
+// not nil, it also checks that every terminal is one of the token types. Productions with EBNF bodies are checked
+// once rewritten, so the production numbers count the helper productions.
+func (g Grammar) Validate(tokenTypes []string) []Diagnostic {
+	diagnostics := make([]Diagnostic, 0)
+	report := func(severity Severity, production int, symbol grammarSymbol, format string, a ...interface{}) {
+		diagnostics = append(diagnostics, Diagnostic{severity, production, symbol, fmt.Sprintf(format, a...)})
+	}
+
+	g, err := g.desugar()
+	if err != nil {
+		report(SeverityError, -1, "", "%v", err)
+		return diagnostics
+	}
+	gi := g.index()
+
+	switch n := len(gi.productionsOf[g.Start]); {
+	case g.Start == "":
+		report(SeverityError, -1, "", "grammar has no start symbol")
+	case n == 0:
+		report(SeverityError, -1, g.Start, "start symbol %v has no production", g.Start)
+	case n > 1:
+		report(SeverityError, -1, g.Start, "start symbol %v has %v productions, it needs exactly one", g.Start, n)
+	}
+	// The parser accepts when it reduces by the production of the start symbol, so the start symbol cannot be
+	// nested in the input.
+	for i, p := range g.Productions {
+		for _, s := range p.Body {
+			if s == g.Start {
+				report(SeverityError, i, g.Start, "start symbol %v appears in the body of %v", g.Start, formatProduction(p))
+				break
+			}
+		}
+	}
+
+	if tokenTypes != nil {
+		isTokenType := make(setOfSymbols)
+		for _, tokenType := range tokenTypes {
+			isTokenType.add(grammarSymbol(tokenType))
+		}
+		reported := make(setOfSymbols)
+		for i, p := range g.Productions {
+			for _, s := range p.Body {
+				if gi.isTerminal(s) && s != errorSymbol && !isTokenType.has(s) && !reported.has(s) {
+					reported.add(s)
+					report(SeverityError, i, s, "terminal %v of %v has no regular expression", s, formatProduction(p))
+				}
+			}
+		}
+	}
+
+	for i, p := range g.Productions {
+		needsChildren, ok := knownRuleTypes[p.Rule.Type]
+		if !ok {
+			report(SeverityError, i, "", "unknown rule type %q in %v", p.Rule.Type, formatProduction(p))
+			continue
+		}
+		if needsChildren && len(p.Rule.Children) == 0 {
+			report(SeverityError, i, "", "%v rule of %v has no children", p.Rule.Type, formatProduction(p))
+		}
+		for _, child := range p.Rule.Children {
+			if child < 0 || child >= len(p.Body) {
+				report(SeverityError, i, "", "child %v of the rule of %v is out of range", child, formatProduction(p))
+			}
+		}
+		if len(p.Rule.Attributes) > 0 && p.Rule.Type != "tree" && p.Rule.Type != "leaf" {
+			report(SeverityError, i, "", "%v rule of %v cannot have attributes", p.Rule.Type, formatProduction(p))
+		}
+		values := []string{p.Rule.RootLabel}
+		for _, name := range sortedKeys(p.Rule.Attributes) {
+			values = append(values, p.Rule.Attributes[name])
+		}
+		for _, value := range values {
+			if child, ok := parseChildReference(value); ok && child >= len(p.Body) {
+				report(SeverityError, i, "", "%v in the rule of %v is out of range", value, formatProduction(p))
+			}
+		}
+	}
+
+	reachable := gi.computeReachable()
+	productive := gi.computeProductive()
+	for _, head := range gi.heads() {
+		if !productive.has(head) {
+			report(SeverityError, -1, head, "%v does not derive any string of terminals", head)
+		}
+		if !reachable.has(head) {
+			report(SeverityWarning, -1, head, "%v cannot be reached from the start symbol", head)
+		}
+	}
+
+	return diagnostics
+}
+
+// heads returns the non terminals in the order their first production comes in.
+func (gi *grammarIndex) heads() []grammarSymbol {
+	heads := make([]grammarSymbol, 0, len(gi.productionsOf))
+	for i, p := range gi.g.Productions {
+		if gi.productionsOf[p.Head][0] == i {
+			heads = append(heads, p.Head)
+		}
+	}
+	return heads
+}
+
+// computeReachable returns the non terminals found in sentential forms derived from the start symbol.
+func (gi *grammarIndex) computeReachable() setOfSymbols {
+	reachable := make(setOfSymbols)
+	pending := []grammarSymbol{gi.g.Start}
+	for len(pending) > 0 {
+		s := pending[len(pending)-1]
+		pending = pending[:len(pending)-1]
+		if reachable.has(s) || gi.isTerminal(s) {
+			continue
+		}
+		reachable.add(s)
+		for _, p := range gi.productionsOf[s] {
+			pending = append(pending, gi.g.Productions[p].Body...)
+		}
+	}
+	return reachable
+}
+
+// computeProductive returns the non terminals deriving at least one string of terminals. A non terminal is
+// productive once one of its bodies only has terminals and productive non terminals.
+func (gi *grammarIndex) computeProductive() setOfSymbols {
+	productive := make(setOfSymbols)
+	for changed := true; changed; {
+		changed = false
+		for _, p := range gi.g.Productions {
+			if productive.has(p.Head) {
+				continue
+			}
+			bodyIsProductive := true
+			for _, s := range p.Body {
+				if !gi.isTerminal(s) && !productive.has(s) {
+					bodyIsProductive = false
+					break
+				}
+			}
+			if bodyIsProductive {
+				productive.add(p.Head)
+				changed = true
+			}
+		}
+	}
+	return productive
+}
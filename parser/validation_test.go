@@ -0,0 +1,148 @@
+package parser
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	var testData = []struct {
+		g                   Grammar
+		tokenTypes          []string
+		expectedDiagnostics []string
+	}{
+		{
+			nullableGrammar,
+			[]string{"id", "(", ")", ",", "!", "?"},
+			[]string{},
+		},
+		{
+			nullableGrammar,
+			[]string{"id", "(", ")"},
+			[]string{
+				"error: terminal , of arglist -> arglist , id has no regular expression",
+				"error: terminal ! of bang -> ! has no regular expression",
+				"error: terminal ? of question -> ? has no regular expression",
+			},
+		},
+		{
+			Grammar{Start: "s", Productions: []Production{
+				{Head: "s", Body: []grammarSymbol{"a"}},
+				{Head: "s", Body: []grammarSymbol{"b"}},
+			}},
+			nil,
+			[]string{"error: start symbol s has 2 productions, it needs exactly one"},
+		},
+		{
+			Grammar{Start: "s", Productions: []Production{
+				{Head: "s", Body: []grammarSymbol{"a"}},
+				{Head: "a", Body: []grammarSymbol{"x", "s"}, Rule: SemanticRule{Type: "tree", RootLabel: "a", Children: []int{0, 1}}},
+				{Head: "a", Body: []grammarSymbol{"y"}},
+			}},
+			nil,
+			[]string{"error: start symbol s appears in the body of a -> x s"},
+		},
+		{
+			Grammar{Start: "s'", Productions: []Production{
+				{Head: "s", Body: []grammarSymbol{"a"}},
+			}},
+			nil,
+			[]string{"error: start symbol s' has no production", "warning: s cannot be reached from the start symbol"},
+		},
+		{
+			Grammar{Start: "s'", Productions: []Production{
+				{Head: "s'", Body: []grammarSymbol{"s"}},
+				{Head: "s", Body: []grammarSymbol{"s", "a"}, Rule: SemanticRule{Type: "tree", RootLabel: "a", Children: []int{0, 2}}},
+				{Head: "s", Body: []grammarSymbol{"t"}, Rule: SemanticRule{Type: "copy", Children: []int{}}},
+				{Head: "t", Body: []grammarSymbol{"(", "t", ")"}, Rule: SemanticRule{Type: "Tree", RootLabel: "t", Children: []int{1}}},
+				{Head: "u", Body: []grammarSymbol{"a"}},
+			}},
+			nil,
+			[]string{
+				"error: child 2 of the rule of s -> s a is out of range",
+				"error: copy rule of s -> t has no children",
+				"error: unknown rule type \"Tree\" in t -> ( t )",
+				"error: s' does not derive any string of terminals",
+				"error: s does not derive any string of terminals",
+				"error: t does not derive any string of terminals",
+				"warning: u cannot be reached from the start symbol",
+			},
+		},
+		{
+			Grammar{Start: "s'", Productions: []Production{
+				{Head: "s'", EBNF: "s"},
+				{Head: "s", Rule: SemanticRule{Type: "tree", RootLabel: "s", Children: []int{0, 2}}, EBNF: "a b* c | d"},
+			}},
+			[]string{"a", "b", "c"},
+			[]string{
+				"error: terminal d of s -> d has no regular expression",
+				"error: child 2 of the rule of s -> d is out of range",
+			},
+		},
+		{
+			Grammar{Start: "s'", Productions: []Production{
+				{Head: "s'", Body: []grammarSymbol{"s"}, Rule: SemanticRule{Type: "copy", Children: []int{0}, Attributes: map[string]string{"kind": "s"}}},
+				{Head: "s", Body: []grammarSymbol{"a", "b"}, Rule: SemanticRule{Type: "tree", RootLabel: "$2", Children: []int{0}}},
+				{Head: "s", Body: []grammarSymbol{"a"}, Rule: SemanticRule{Type: "leaf", RootLabel: "a", Attributes: map[string]string{"name": "$1"}}},
+			}},
+			nil,
+			[]string{
+				"error: copy rule of s' -> s cannot have attributes",
+				"error: $2 in the rule of s -> a b is out of range",
+				"error: leaf rule of s -> a has no children",
+				"error: $1 in the rule of s -> a is out of range",
+			},
+		},
+		{
+			Grammar{Start: "s'", Productions: []Production{
+				{Head: "s'", EBNF: "s)"},
+			}},
+			nil,
+			[]string{"error: EBNF body of production 0 of s': unexpected )"},
+		},
+	}
+
+	for i, test := range testData {
+		diagnostics := make([]string, 0)
+		for _, d := range test.g.Validate(test.tokenTypes) {
+			diagnostics = append(diagnostics, d.String())
+		}
+		if !reflect.DeepEqual(diagnostics, test.expectedDiagnostics) {
+			t.Errorf("Expected grammar %v to have diagnostics %q, got %q", i, test.expectedDiagnostics, diagnostics)
+		}
+	}
+}
+
+func TestInitValidationError(t *testing.T) {
+	g := Grammar{Start: "s'", Productions: []Production{
+		{Head: "s'", Body: []grammarSymbol{"s"}},
+		{Head: "s", Body: []grammarSymbol{"a"}, Rule: SemanticRule{Type: "copy", Children: []int{1}}},
+		{Head: "u", Body: []grammarSymbol{"a"}},
+	}}
+	var P Parser
+	err := P.Init(g)
+	validationError, ok := err.(*ValidationError)
+	if !ok {
+		t.Fatalf("Expected a *ValidationError, got %v", err)
+	}
+	expectedMessage := "grammar has 1 errors\nerror: child 1 of the rule of s -> a is out of range"
+	if validationError.Error() != expectedMessage {
+		t.Errorf("Expected %q, got %q", expectedMessage, validationError.Error())
+	}
+}
+
+func TestInitWithTokenTypes(t *testing.T) {
+	g := Grammar{Start: "s'", Productions: []Production{
+		{Head: "s'", Body: []grammarSymbol{"s"}},
+		{Head: "s", Body: []grammarSymbol{"a", "b"}},
+	}}
+	var P Parser
+	if err := P.InitWithTokenTypes(g, []string{"a", "b"}); err != nil {
+		t.Errorf("Expected parser to compile, got %v", err)
+	}
+	err := P.InitWithTokenTypes(g, []string{"a"})
+	expectedMessage := "grammar has 1 errors\nerror: terminal b of s -> a b has no regular expression"
+	if _, ok := err.(*ValidationError); !ok || err.Error() != expectedMessage {
+		t.Errorf("Expected error %q, got %v", expectedMessage, err)
+	}
+}